@@ -0,0 +1,347 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "fmt"
+  "math"
+  "math/big"
+  "reflect"
+  "strconv"
+)
+
+/**
+ * Number is implemented by numeric types which provide their own arithmetic,
+ * such as decimals, so that they can be used with the arithmetic and
+ * comparison operators.
+ * 
+ * When a Number is used with an operand of a different type, that operand is
+ * first converted by the Number's Coerce method. The value provided to Coerce
+ * is an int64, uint64, float64, *big.Int, *big.Rat, *big.Float or another
+ * Number; a decimal literal like 1.5 is provided exactly, as a *big.Rat. An
+ * implementation returns an error for values it cannot represent.
+ * The operands provided to the arithmetic methods are always of the same type
+ * as the receiver, and the receiver must not be modified.
+ */
+type Number interface {
+  Coerce(v interface{}) (Number, error)
+  Add(v Number) (Number, error)
+  Sub(v Number) (Number, error)
+  Mul(v Number) (Number, error)
+  Quo(v Number) (Number, error)
+  Cmp(v Number) (int, error)
+}
+
+/**
+ * Ranks of numbers with arbitrary precision. Operands are promoted to the
+ * highest ranked type of the two.
+ */
+const (
+  rankInteger = iota
+  rankBigInt
+  rankBigRat
+  rankBigFloat
+)
+
+/**
+ * Determine if a value is an arbitrary-precision number or a Number
+ */
+func isBigNumber(v interface{}) bool {
+  switch v.(type) {
+    case *big.Int, *big.Rat, *big.Float, Number:
+      return true
+    default:
+      return false
+  }
+}
+
+/**
+ * Perform an arithmetic operation on operands, at least one of which is an
+ * arbitrary-precision number or a Number. The operands are never modified.
+ */
+func bigArithmetic(op tokenType, a, b interface{}) (interface{}, error) {
+  
+  x, y, err := bigOperands(a, b)
+  if err != nil {
+    return nil, err
+  }
+  
+  switch x := x.(type) {
+    
+    case Number:
+      y := y.(Number)
+      switch op {
+        case tokenAdd:
+          return x.Add(y)
+        case tokenSub:
+          return x.Sub(y)
+        case tokenMul:
+          return x.Mul(y)
+        case tokenDiv:
+          return x.Quo(y)
+      }
+      
+    case *big.Int:
+      y := y.(*big.Int)
+      switch op {
+        case tokenAdd:
+          return new(big.Int).Add(x, y), nil
+        case tokenSub:
+          return new(big.Int).Sub(x, y), nil
+        case tokenMul:
+          return new(big.Int).Mul(x, y), nil
+        case tokenDiv: // truncated, like Go integer division
+          if y.Sign() == 0 {
+            return nil, errDivisionByZero
+          }
+          return new(big.Int).Quo(x, y), nil
+        case tokenMod:
+          if y.Sign() == 0 {
+            return nil, errDivisionByZero
+          }
+          return new(big.Int).Rem(x, y), nil
+      }
+      
+    case *big.Rat:
+      y := y.(*big.Rat)
+      switch op {
+        case tokenAdd:
+          return new(big.Rat).Add(x, y), nil
+        case tokenSub:
+          return new(big.Rat).Sub(x, y), nil
+        case tokenMul:
+          return new(big.Rat).Mul(x, y), nil
+        case tokenDiv:
+          if y.Sign() == 0 {
+            return nil, fmt.Errorf("Division by zero")
+          }
+          return new(big.Rat).Quo(x, y), nil
+      }
+      
+    case *big.Float:
+      y := y.(*big.Float)
+      switch op {
+        case tokenAdd:
+          return new(big.Float).Add(x, y), nil
+        case tokenSub:
+          return new(big.Float).Sub(x, y), nil
+        case tokenMul:
+          return new(big.Float).Mul(x, y), nil
+        case tokenDiv:
+          if x.Sign() == 0 && y.Sign() == 0 {
+            return nil, fmt.Errorf("Division of zero by zero")
+          }
+          return new(big.Float).Quo(x, y), nil
+      }
+      
+  }
+  
+  return nil, fmt.Errorf("Operator %v is not defined for %T", op, x)
+}
+
+/**
+ * Compare operands, at least one of which is an arbitrary-precision number
+ * or a Number.
+ */
+func bigCompare(a, b interface{}) (int, error) {
+  
+  x, y, err := bigOperands(a, b)
+  if err != nil {
+    return 0, err
+  }
+  
+  switch x := x.(type) {
+    case Number:
+      return x.Cmp(y.(Number))
+    case *big.Int:
+      return x.Cmp(y.(*big.Int)), nil
+    case *big.Rat:
+      return x.Cmp(y.(*big.Rat)), nil
+    case *big.Float:
+      return x.Cmp(y.(*big.Float)), nil
+    default:
+      return 0, fmt.Errorf("Cannot compare %T", x)
+  }
+  
+}
+
+/**
+ * Obtain the value of an operand for arbitrary-precision arithmetic given the
+ * expression which produced it. A decimal literal, which is otherwise the
+ * nearest float64, is represented exactly by a *big.Rat.
+ */
+func exactOperand(e expression, v interface{}) interface{} {
+  if n, ok := e.(*numberNode); ok && n.exact != nil {
+    return new(big.Rat).Set(n.exact)
+  }
+  return v
+}
+
+/**
+ * Negate an arbitrary-precision number or a Number
+ */
+func bigNegate(v interface{}) (interface{}, error) {
+  switch n := v.(type) {
+    case Number:
+      return bigArithmetic(tokenSub, int64(0), n)
+    case *big.Int:
+      return new(big.Int).Neg(n), nil
+    case *big.Rat:
+      return new(big.Rat).Neg(n), nil
+    case *big.Float:
+      return new(big.Float).Neg(n), nil
+    default:
+      return nil, fmt.Errorf("Cannot negate %T", v)
+  }
+}
+
+/**
+ * Convert a pair of operands to the same type. If either operand is a Number
+ * the other is coerced by it; otherwise both operands are promoted to the
+ * higher ranked type of the two.
+ */
+func bigOperands(a, b interface{}) (interface{}, interface{}, error) {
+  
+  a, err := bigOperand(a)
+  if err != nil {
+    return nil, nil, err
+  }
+  b, err = bigOperand(b)
+  if err != nil {
+    return nil, nil, err
+  }
+  
+  if x, ok := a.(Number); ok {
+    if reflect.TypeOf(a) == reflect.TypeOf(b) {
+      return a, b, nil
+    }
+    y, err := x.Coerce(b)
+    return x, y, err
+  }
+  if y, ok := b.(Number); ok {
+    x, err := y.Coerce(a)
+    return x, y, err
+  }
+  
+  switch max(bigRank(a), bigRank(b)) {
+    case rankBigInt:
+      return toBigInt(a), toBigInt(b), nil
+    case rankBigRat:
+      return toBigRat(a), toBigRat(b), nil
+    default:
+      return toBigFloat(a), toBigFloat(b), nil
+  }
+  
+}
+
+/**
+ * Validate an operand and normalize primitive numbers to int64, uint64 or
+ * float64.
+ */
+func bigOperand(v interface{}) (interface{}, error) {
+  if isBigNumber(v) {
+    if isNil(v) {
+      return nil, fmt.Errorf("Cannot use nil %T as a number", v)
+    }
+    return v, nil
+  }
+  if r := reflect.ValueOf(v); isNumericKind(r.Kind()) {
+    n := normalizeNumber(r)
+    if f, ok := n.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+      return nil, fmt.Errorf("Cannot use %v with an arbitrary-precision number", f)
+    }
+    return n, nil
+  }
+  return nil, fmt.Errorf("Cannot cast %v to numeric", displayType(reflect.ValueOf(v)))
+}
+
+/**
+ * Rank a normalized operand
+ */
+func bigRank(v interface{}) int {
+  switch v.(type) {
+    case *big.Int:
+      return rankBigInt
+    case *big.Rat, float64:
+      return rankBigRat
+    case *big.Float:
+      return rankBigFloat
+    default:
+      return rankInteger
+  }
+}
+
+/**
+ * Convert an integer operand to a big integer
+ */
+func toBigInt(v interface{}) *big.Int {
+  switch n := v.(type) {
+    case *big.Int:
+      return n
+    case int64:
+      return big.NewInt(n)
+    default:
+      return new(big.Int).SetUint64(v.(uint64))
+  }
+}
+
+/**
+ * Convert an integer, float or rational operand to a big rational. A float is
+ * converted from its shortest decimal representation, so that 0.1 is 1/10
+ * rather than the binary fraction nearest to it.
+ */
+func toBigRat(v interface{}) *big.Rat {
+  switch n := v.(type) {
+    case *big.Rat:
+      return n
+    case float64:
+      r, _ := new(big.Rat).SetString(strconv.FormatFloat(n, 'g', -1, 64))
+      return r
+    default:
+      return new(big.Rat).SetInt(toBigInt(v))
+  }
+}
+
+/**
+ * Convert an operand to a big float
+ */
+func toBigFloat(v interface{}) *big.Float {
+  switch n := v.(type) {
+    case *big.Float:
+      return n
+    case float64:
+      return big.NewFloat(n)
+    case *big.Rat:
+      return new(big.Float).SetRat(n)
+    default:
+      return new(big.Float).SetInt(toBigInt(v))
+  }
+}
@@ -0,0 +1,184 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "fmt"
+  "math/big"
+  "testing"
+)
+
+/**
+ * A fixed-point decimal with two places, for testing Number
+ */
+type testDecimal int64
+
+func (d testDecimal) Coerce(v interface{}) (Number, error) {
+  switch n := v.(type) {
+    case int64:
+      return testDecimal(n * 100), nil
+    case *big.Rat:
+      r := new(big.Rat).Mul(n, big.NewRat(100, 1))
+      if !r.IsInt() || !r.Num().IsInt64() {
+        return nil, fmt.Errorf("Cannot represent %v as a decimal", n.RatString())
+      }
+      return testDecimal(r.Num().Int64()), nil
+    default:
+      return nil, fmt.Errorf("Cannot use %T as a decimal", v)
+  }
+}
+
+func (d testDecimal) Add(v Number) (Number, error) {
+  return d + v.(testDecimal), nil
+}
+
+func (d testDecimal) Sub(v Number) (Number, error) {
+  return d - v.(testDecimal), nil
+}
+
+func (d testDecimal) Mul(v Number) (Number, error) {
+  return d * v.(testDecimal) / 100, nil
+}
+
+func (d testDecimal) Quo(v Number) (Number, error) {
+  if v.(testDecimal) == 0 {
+    return nil, fmt.Errorf("Division by zero")
+  }
+  return d * 100 / v.(testDecimal), nil
+}
+
+func (d testDecimal) Cmp(v Number) (int, error) {
+  return compareOrdered(int64(d), int64(v.(testDecimal))), nil
+}
+
+func (d testDecimal) String() string {
+  if d < 0 {
+    return "-"+(-d).String()
+  }
+  return fmt.Sprintf("%d.%02d", int64(d) / 100, int64(d) % 100)
+}
+
+func TestBigNumbers(t *testing.T) {
+  
+  huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": huge, "b": big.NewInt(10)},
+    `@(a + 1) @(a * b) @(a / b) @(a % 11) @(-b) @(b * 2 == 20) @(a > b) @(b < 3)`,
+    `123456789012345678901234567891 1234567890123456789012345678900 12345678901234567890123456789 7 -10 true true false`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": big.NewRat(1, 10), "b": big.NewRat(2, 10)},
+    `@(a + b) @((a + b) * 3) @(a / b) @(a - 1) @(a * 2 == b) @x := a + b;@(x.FloatString(2))`,
+    `3/10 9/10 1/2 -9/10 true 0.30`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": big.NewFloat(1.5), "b": big.NewInt(2), "c": big.NewRat(1, 2)},
+    `@(a * b) @(a + 0.25) @(a > 1) @(a + c)`,
+    `3 1.75 true 2`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": big.NewInt(1)},
+    `@(a / 0)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": big.NewRat(1, 10), "b": big.NewInt(3)},
+    `@(a * 0.1) @(a == 0.1) @(a + -0.05) @(a < 0.1) @(b * 1.5) @(0.2 - a)`,
+    `1/100 true 1/20 false 9/2 1/10`,
+  )
+  
+  // arithmetic on decimal literals is exact, and floats are converted from
+  // their shortest decimal representation
+  compileAndRun(t, true, true, map[string]interface{}{"price": big.NewRat(1999, 100), "b": big.NewInt(3), "f": 0.1},
+    `@(price * (1 + 0.15)) @(decimal(price * (1 + 0.15), 4)) @r := 0.15;@(price * r) @(b * f) @(price * -(0.5 - 1)) @(0.1 + 0.2) @(price > 19.99 - 0.01 * 2)`,
+    `45977/2000 22.9885 5997/2000 3/10 1999/200 0.3 true`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": big.NewRat(1, 3), "b": big.NewFloat(1.5), "c": big.NewInt(2), "d": big.NewRat(-1, 200)},
+    `@(decimal(a, 2)) @(decimal(a * 0.1, 3)) @(decimal(b, 2)) @(decimal(c, 1)) @(decimal(3, 2)) @(decimal(1.5, 0)) @(decimal(d, 2)) @(a * 0.3 | decimal(1))`,
+    `0.33 0.033 1.50 2.0 3.00 2 -0.01 0.1`,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(decimal("a", 2))`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(decimal(1, -1))`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": (*big.Rat)(nil)},
+    `@(decimal(a, 2))`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": big.NewRat(1, 2)},
+    `@(a % 2)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": big.NewInt(1)},
+    `@(a + "b")`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": (*big.Int)(nil)},
+    `@(a + 1)`,
+    ``,
+  )
+  
+}
+
+func TestNumberInterface(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"price": testDecimal(1999), "tax": testDecimal(160)},
+    `@(price + tax) @(price * 3) @(price - 20) @(100 - price) @(price / 2) @(-tax) @(price > tax) @(tax == 1) @(tax < 2)`,
+    `21.59 59.97 -0.01 80.01 9.99 -1.60 true false true`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"price": testDecimal(1999), "tax": testDecimal(160)},
+    `@(tax * 1.5) @(price + 0.01) @(price > 19.98) @(-0.5 * tax) @(tax * (1 + 0.5)) @(tax * (0.1 + 0.2))`,
+    `2.40 20.00 true -0.80 2.40 0.48`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"price": testDecimal(1999)},
+    `@(price * 1.005)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"price": testDecimal(1999)},
+    `@(price % 2)`,
+    ``,
+  )
+  
+}
@@ -0,0 +1,73 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test capture
+ */
+func TestCapture(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"name": "Products"},
+    `@capture title {All @(name)}<title>@(title)</title><h1>@(title)</h1>`,
+    `<title>All Products</title><h1>All Products</h1>`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@capture list {@for _, e := range a {@(e);}}@(len(list)): @(list)`,
+    `6: 1;2;3;`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@if true {@capture x {X}@(x)@(x)}`,
+    `XX`,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@capture x {@(undefined())}@(x)`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"name": "<Products>"},
+    `<script>@capture title {<b>@(name)</b>}</script><h1>@(title)</h1><p>@(title)</p>`,
+    `<script></script><h1><b>&lt;Products&gt;</b></h1><p><b>&lt;Products&gt;</b></p>`,
+  )
+  
+  // captured output isn't escaped again in a title or an attribute
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"n": "Tom & Jerry", "s": `"Cartoons"`},
+    `@capture title {<i>@(n)</i> | @(s)}<title>@(title)</title><meta content="@(title)"><h1>@(title)</h1>`,
+    `<title>Tom &amp; Jerry | &#34;Cartoons&#34;</title><meta content="Tom &amp; Jerry | &#34;Cartoons&#34;"><h1><i>Tom &amp; Jerry</i> | &#34;Cartoons&#34;</h1>`,
+  )
+  
+}
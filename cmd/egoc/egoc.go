@@ -47,6 +47,8 @@ func main() {
   fContext  := cmdline.String   ("context",   "",       "Path to the context data to be used when evaluating a source file. This file must be formatted as JSON.")
   fVerbose  := cmdline.Bool     ("verbose",   false,    "Be verbose.")
   fDebug    := cmdline.Bool     ("debug",     false,    "Debug the compiler and runtime (be very verbose).")
+  fHTML     := cmdline.Bool     ("html",      false,    "Escape interpolated values according to their HTML context.")
+  fTrim     := cmdline.Bool     ("trim",      false,    "Remove lines which consist only of statements from the output.")
   cmdline.Parse(os.Args[1:])
   
   if *fVerbose { }
@@ -68,6 +70,13 @@ func main() {
   runtime := &ego.Runtime{
     Stdout: os.Stdout,
   }
+  if *fHTML {
+    runtime.Escape = ego.EscapeHTML
+  }
+  
+  opts := ego.Options{
+    TrimLines: *fTrim,
+  }
   
   for _, p := range cmdline.Args() {
     
@@ -77,12 +86,15 @@ func main() {
       return
     }
     
-    prog, err := ego.Compile(string(src))
+    prog, err := ego.CompileWithOptions(string(src), opts)
     if err != nil {
       fmt.Fprintf(os.Stderr, "%v: %v: %v\n", CMD, p, err)
       return
     }
     
+    // included templates are resolved relative to the including source
+    runtime.Loader = &ego.FSLoader{FS:os.DirFS(path.Dir(p)), Options:opts}
+    
     err = prog.Exec(runtime, context)
     if err != nil {
       fmt.Fprintf(os.Stderr, "\n%v: %v: %v\n", CMD, p, err)
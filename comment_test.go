@@ -0,0 +1,97 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test comments
+ */
+func TestComments(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `Hello, @* this is a comment *@world.`,
+    `Hello, world.`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `A @* a comment containing @(meta) and { braces } *@B`,
+    `A B`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    "A\n@// a line comment @(meta)\nB",
+    "A\n\nB",
+  )
+  
+  compileAndRun(t, true, true, nil,
+    "A @// a comment at the end",
+    "A ",
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": true},
+    `@if a {A @* comment *@B}`,
+    `A B`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `user\@* not a comment *\@`,
+    `user@* not a comment *@`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1},
+    `@(a /* one */ + /* two */ 2)`,
+    `3`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1},
+    "@if a == 1 // a comment\n { A }",
+    " A ",
+  )
+  
+  compileAndRun(t, true, true, nil,
+    "@x := 1 // declare x\n@(x)",
+    "\n1",
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `A @* unterminated`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@(1 /* unterminated)`,
+    ``,
+  )
+  
+}
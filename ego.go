@@ -33,9 +33,28 @@ package ego
 // trace tokens as a program is parsed
 var DEBUG_TRACE_TOKEN bool
 
+/**
+ * Compilation options
+ */
+type Options struct {
+  // When TrimLines is true, lines which consist only of statements, such as
+  // '@if x {' or '}', and whitespace are removed from the output along with
+  // their newlines. This is useful when generating whitespace-sensitive text.
+  TrimLines bool
+}
+
 /**
  * Compile a program
  */
 func Compile(src string) (*Program, error) {
-  return newParser(newScanner(src)).parse()
+  return CompileWithOptions(src, Options{})
+}
+
+/**
+ * Compile a program with options
+ */
+func CompileWithOptions(src string, opts Options) (*Program, error) {
+  s := newScanner(src)
+  s.trim = opts.TrimLines
+  return newParser(s).parse()
 }
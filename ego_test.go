@@ -101,12 +101,16 @@ func compileAndValidate(t *testing.T, source string, expect []token) {
 }
 
 func compileAndRun(t *testing.T, compile, exec bool, context interface{}, source, expect string) {
+  compileAndRunRuntime(t, &Runtime{}, compile, exec, context, source, expect)
+}
+
+func compileAndRunRuntime(t *testing.T, runtime *Runtime, compile, exec bool, context interface{}, source, expect string) {
   fmt.Println(source)
   
   output  := &bytes.Buffer{}
   scanner := newScanner(source)
   parser  := newParser(scanner)
-  runtime := &Runtime{Stdout:output}
+  runtime.Stdout = output
   
   program, err := parser.parse()
   if compile {
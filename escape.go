@@ -0,0 +1,710 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "fmt"
+  "html"
+  "regexp"
+  "strings"
+  "net/url"
+  "encoding/json"
+)
+
+/**
+ * Output escaping mode
+ */
+type EscapeMode int
+
+const (
+  EscapeNone EscapeMode = iota  // interpolated values are written as-is
+  EscapeHTML                    // interpolated values are escaped according to their HTML context
+)
+
+/**
+ * Trusted content types. A value of one of these types is written without
+ * escaping when it is interpolated in the corresponding context.
+ */
+type (
+  SafeHTML  string  // markup, trusted in text; elsewhere its tags are removed but its character references are kept
+  SafeURL   string  // a URL, trusted in URL attribute values
+  SafeJS    string  // a script expression, trusted in scripts and event handler attributes
+  SafeCSS   string  // a style declaration or value, trusted in stylesheets and style attributes
+)
+
+/**
+ * Replacement for values that cannot be safely interpolated in their context
+ */
+const unsafeContent = "ZegoZ"
+
+/**
+ * HTML context state
+ */
+type htmlState int
+
+const (
+  htmlText htmlState = iota // between tags
+  htmlTagOpen               // after '<'
+  htmlEndTagOpen            // after '</'
+  htmlDecl                  // in a declaration, e.g., <!DOCTYPE ...>
+  htmlComment               // in a comment, <!-- ... -->
+  htmlTagName               // in a tag name
+  htmlTag                   // in a tag, between attributes
+  htmlAttrName              // in an attribute name
+  htmlAfterAttrName         // after an attribute name, before '='
+  htmlBeforeValue           // after '=', before an attribute value
+  htmlAttr                  // in an attribute value
+  htmlRawText               // in the content of a raw text element (script, style, etc)
+)
+
+/**
+ * Attribute value type
+ */
+type attrType int
+
+const (
+  attrNormal attrType = iota
+  attrURL
+  attrJS
+  attrCSS
+)
+
+/**
+ * Position within a URL
+ */
+type urlPart int
+
+const (
+  urlStart urlPart = iota // nothing has been written yet
+  urlPath                 // before any '?' or '#'
+  urlQuery                // in the query or fragment
+)
+
+/**
+ * Position within a script or stylesheet
+ */
+type codeState int
+
+const (
+  codeNormal codeState = iota
+  codeDqString
+  codeSqString
+  codeTplString // JS only
+)
+
+/**
+ * Attributes which contain URLs
+ */
+var urlAttrs = map[string]struct{}{
+  "action": {}, "background": {}, "cite": {}, "codebase": {}, "data": {}, "formaction": {}, "href": {},
+  "icon": {}, "longdesc": {}, "manifest": {}, "poster": {}, "profile": {}, "src": {}, "srcset": {}, "usemap": {},
+}
+
+/**
+ * Elements whose content is not parsed as markup
+ */
+var rawTextElements = map[string]struct{}{
+  "script": {}, "style": {}, "textarea": {}, "title": {},
+}
+
+/**
+ * HTML escaping context. This is advanced as verbatim content is written so
+ * that interpolated values can be escaped appropriately for wherever they
+ * happen to appear in the document.
+ */
+type htmlContext struct {
+  state     htmlState
+  element   string    // the current (or most recent) tag name
+  endTag    bool      // is the current tag an end tag
+  attr      string    // the current attribute name
+  atype     attrType  // the current attribute value type
+  delim     byte      // the current attribute value delimiter, or 0 if unquoted
+  url       urlPart
+  code      codeState
+  escaped   bool      // the previous byte in a code string was a '\'
+  dashes    int       // consecutive '-' in a comment
+  pending   string    // possible raw text element end tag
+}
+
+/**
+ * Advance the context over written content
+ */
+func (c *htmlContext) advance(s string) {
+  for i := 0; i < len(s); i++ {
+    c.next(s[i])
+  }
+}
+
+/**
+ * Advance the context over a single byte
+ */
+func (c *htmlContext) next(b byte) {
+  switch c.state {
+    
+    case htmlText:
+      if b == '<' {
+        c.state = htmlTagOpen
+      }
+      
+    case htmlTagOpen:
+      switch {
+        case isASCIILetter(b):
+          c.startTag(b, false)
+        case b == '/':
+          c.state = htmlEndTagOpen
+        case b == '!':
+          c.state, c.dashes = htmlDecl, 0
+        default:
+          c.state = htmlText
+          c.next(b)
+      }
+      
+    case htmlEndTagOpen:
+      if isASCIILetter(b) {
+        c.startTag(b, true)
+      }else{
+        c.state = htmlText
+        c.next(b)
+      }
+      
+    case htmlDecl:
+      if b == '-' {
+        c.dashes++
+        if c.dashes == 2 {
+          c.state, c.dashes = htmlComment, 0
+        }
+      }else if b == '>' {
+        c.state = htmlText
+      }else{
+        c.dashes = -1 // not a comment
+      }
+      
+    case htmlComment:
+      if b == '-' {
+        c.dashes++
+      }else{
+        if b == '>' && c.dashes >= 2 {
+          c.state = htmlText
+        }
+        c.dashes = 0
+      }
+      
+    case htmlTagName:
+      switch {
+        case isHTMLSpace(b) || b == '/':
+          c.state = htmlTag
+        case b == '>':
+          c.endOfTag()
+        default:
+          c.element += strings.ToLower(string(b))
+      }
+      
+    case htmlTag:
+      switch {
+        case isHTMLSpace(b) || b == '/':
+          // stay in the tag
+        case b == '>':
+          c.endOfTag()
+        default:
+          c.state, c.attr = htmlAttrName, strings.ToLower(string(b))
+      }
+      
+    case htmlAttrName:
+      switch {
+        case b == '=':
+          c.state = htmlBeforeValue
+        case isHTMLSpace(b):
+          c.state = htmlAfterAttrName
+        case b == '/':
+          c.state = htmlTag
+        case b == '>':
+          c.endOfTag()
+        default:
+          c.attr += strings.ToLower(string(b))
+      }
+      
+    case htmlAfterAttrName:
+      switch {
+        case isHTMLSpace(b):
+          // stay after the name
+        case b == '=':
+          c.state = htmlBeforeValue
+        case b == '>':
+          c.endOfTag()
+        default:
+          c.state, c.attr = htmlAttrName, strings.ToLower(string(b))
+      }
+      
+    case htmlBeforeValue:
+      switch {
+        case isHTMLSpace(b):
+          // stay before the value
+        case b == '"' || b == '\'':
+          c.startAttr(b)
+        case b == '>':
+          c.endOfTag()
+        default:
+          c.startAttr(0)
+          c.next(b)
+      }
+      
+    case htmlAttr:
+      if (c.delim != 0 && b == c.delim) || (c.delim == 0 && isHTMLSpace(b)) {
+        c.state = htmlTag
+      }else if c.delim == 0 && b == '>' {
+        c.endOfTag()
+      }else{
+        switch c.atype {
+          case attrURL:
+            if b == '?' || b == '#' {
+              c.url = urlQuery
+            }else if c.url == urlStart {
+              c.url = urlPath
+            }
+          case attrJS:
+            c.nextCode(b, true)
+          case attrCSS:
+            c.nextCode(b, false)
+        }
+      }
+      
+    case htmlRawText:
+      end := "</"+ c.element
+      if c.pending != "" || b == '<' {
+        c.pending += strings.ToLower(string(b))
+        if c.pending == end {
+          c.pending = ""
+          c.state, c.endTag = htmlTagName, true
+          return
+        }else if strings.HasPrefix(end, c.pending) {
+          return
+        }
+        c.pending = ""
+      }
+      switch c.element {
+        case "script":
+          c.nextCode(b, true)
+        case "style":
+          c.nextCode(b, false)
+      }
+      
+  }
+}
+
+/**
+ * Advance the string state of a script or stylesheet
+ */
+func (c *htmlContext) nextCode(b byte, js bool) {
+  switch c.code {
+    case codeNormal:
+      switch {
+        case b == '"':
+          c.code = codeDqString
+        case b == '\'':
+          c.code = codeSqString
+        case b == '`' && js:
+          c.code = codeTplString
+      }
+    default:
+      if c.escaped {
+        c.escaped = false
+      }else if b == '\\' {
+        c.escaped = true
+      }else if (c.code == codeDqString && b == '"') || (c.code == codeSqString && b == '\'') || (c.code == codeTplString && b == '`') {
+        c.code = codeNormal
+      }
+  }
+}
+
+/**
+ * Begin a tag
+ */
+func (c *htmlContext) startTag(b byte, end bool) {
+  c.state, c.endTag, c.element = htmlTagName, end, strings.ToLower(string(b))
+}
+
+/**
+ * Finish a tag
+ */
+func (c *htmlContext) endOfTag() {
+  if _, ok := rawTextElements[c.element]; ok && !c.endTag {
+    c.state, c.code, c.escaped, c.pending = htmlRawText, codeNormal, false, ""
+  }else{
+    c.state = htmlText
+  }
+}
+
+/**
+ * Begin an attribute value
+ */
+func (c *htmlContext) startAttr(delim byte) {
+  c.state, c.delim, c.url, c.code, c.escaped = htmlAttr, delim, urlStart, codeNormal, false
+  if _, ok := urlAttrs[c.attr]; ok {
+    c.atype = attrURL
+  }else if strings.HasPrefix(c.attr, "on") {
+    c.atype = attrJS
+  }else if c.attr == "style" {
+    c.atype = attrCSS
+  }else{
+    c.atype = attrNormal
+  }
+}
+
+/**
+ * Escape an interpolated value for the current context and advance the
+ * context over the result. The value's plain text representation is
+ * provided as well as the value itself.
+ */
+func (c *htmlContext) escape(v interface{}, s string) string {
+  var out string
+  
+  if c.state == htmlBeforeValue {
+    c.startAttr(0) // the value begins an unquoted attribute
+  }
+  
+  switch c.state {
+    case htmlText, htmlComment, htmlDecl:
+      if _, ok := v.(SafeHTML); ok {
+        out = s
+      }else{
+        out = html.EscapeString(s)
+      }
+    case htmlTagOpen, htmlEndTagOpen, htmlTagName, htmlTag, htmlAttrName, htmlAfterAttrName:
+      out = filterName(s)
+    case htmlAttr:
+      if _, ok := v.(SafeHTML); ok && c.atype == attrNormal {
+        out = normalizeHTML(s, c.delim == 0)
+        break
+      }
+      switch c.atype {
+        case attrURL:
+          if _, ok := v.(SafeURL); ok {
+            out = s
+          }else{
+            out = escapeURL(s, c.url)
+          }
+        case attrJS:
+          if _, ok := v.(SafeJS); ok {
+            out = s
+          }else{
+            out = escapeJS(v, s, c.code)
+          }
+        case attrCSS:
+          if _, ok := v.(SafeCSS); ok {
+            out = s
+          }else{
+            out = escapeCSS(s, c.code)
+          }
+        default:
+          out = s
+      }
+      if c.delim == 0 {
+        out = escapeUnquotedAttr(out)
+      }else{
+        out = html.EscapeString(out)
+      }
+    case htmlRawText:
+      switch c.element {
+        case "script":
+          if _, ok := v.(SafeJS); ok {
+            out = s
+          }else{
+            out = escapeJS(v, s, c.code)
+          }
+        case "style":
+          if _, ok := v.(SafeCSS); ok {
+            out = s
+          }else{
+            out = escapeCSS(s, c.code)
+          }
+        default:
+          if _, ok := v.(SafeHTML); ok {
+            out = normalizeHTML(s, false)
+          }else{
+            out = html.EscapeString(s)
+          }
+      }
+  }
+  
+  c.advance(out)
+  return out
+}
+
+/**
+ * Normalize trusted markup for a context in which markup isn't permitted, like
+ * an attribute value or the text of a <title> or <textarea> element. Tags are
+ * removed and special characters are escaped, except for '&': the character
+ * references in the markup are already escaped and must not be escaped again.
+ */
+func normalizeHTML(s string, unquoted bool) string {
+  var b strings.Builder
+  s = stripTags(s)
+  for _, r := range s {
+    switch {
+      case r == '&' || (unquoted && (r == '#' || r == ';')): // parts of a character reference
+        b.WriteRune(r)
+      case unquoted && r < 0x80 && !isASCIILetter(byte(r)) && !isASCIIDigit(byte(r)):
+        fmt.Fprintf(&b, "&#%d;", r)
+      case r == '<':
+        b.WriteString("&lt;")
+      case r == '>':
+        b.WriteString("&gt;")
+      case r == '"':
+        b.WriteString("&#34;")
+      case r == '\'':
+        b.WriteString("&#39;")
+      default:
+        b.WriteRune(r)
+    }
+  }
+  return b.String()
+}
+
+/**
+ * Remove the tags and comments from markup. A tag which isn't terminated is
+ * removed along with the remainder of the markup.
+ */
+func stripTags(s string) string {
+  var b strings.Builder
+  for {
+    i := strings.IndexByte(s, '<')
+    if i < 0 || i + 1 >= len(s) {
+      b.WriteString(s)
+      return b.String()
+    }
+    b.WriteString(s[:i])
+    s = s[i:]
+    
+    var end int
+    switch c := s[1]; {
+      case strings.HasPrefix(s, "<!--"):
+        if end = strings.Index(s, "-->"); end >= 0 {
+          end += 3
+        }
+      case isASCIILetter(c) || c == '/' || c == '!' || c == '?':
+        if end = tagEnd(s); end >= 0 {
+          end += 1
+        }
+      default:
+        b.WriteByte('<') // not a tag
+        s = s[1:]
+        continue
+    }
+    if end < 0 {
+      return b.String()
+    }
+    s = s[end:]
+  }
+}
+
+/**
+ * Find the offset of the '>' which ends the tag at the beginning of the
+ * provided markup, skipping over quoted attribute values, or -1 if the tag
+ * isn't terminated
+ */
+func tagEnd(s string) int {
+  var quote byte
+  for i := 1; i < len(s); i++ {
+    switch c := s[i]; {
+      case quote != 0:
+        if c == quote {
+          quote = 0
+        }
+      case c == '"' || c == '\'':
+        quote = c
+      case c == '>':
+        return i
+    }
+  }
+  return -1
+}
+
+/**
+ * Filter a tag or attribute name
+ */
+func filterName(s string) string {
+  if s == "" {
+    return unsafeContent
+  }
+  for i := 0; i < len(s); i++ {
+    if b := s[i]; !isASCIILetter(b) && !isASCIIDigit(b) && b != '-' && b != '_' && b != ':' {
+      return unsafeContent
+    }
+  }
+  return s
+}
+
+/**
+ * Escape an unquoted attribute value
+ */
+func escapeUnquotedAttr(s string) string {
+  var b strings.Builder
+  for _, r := range s {
+    if r < 0x80 && !isASCIILetter(byte(r)) && !isASCIIDigit(byte(r)) {
+      fmt.Fprintf(&b, "&#%d;", r)
+    }else{
+      b.WriteRune(r)
+    }
+  }
+  return b.String()
+}
+
+/**
+ * Escape a URL or part of a URL. A value that begins a URL must not have
+ * an unsafe scheme and is normalized; within a URL the value is normalized
+ * if it appears in the path and is query-escaped otherwise.
+ */
+func escapeURL(s string, part urlPart) string {
+  switch part {
+    case urlStart:
+      if i := strings.IndexAny(s, ":/?#"); i > 0 && s[i] == ':' {
+        switch strings.ToLower(s[:i]) {
+          case "http", "https", "mailto":
+            // safe scheme
+          default:
+            return "#"+ unsafeContent
+        }
+      }
+      return normalizeURL(s)
+    case urlPath:
+      return normalizeURL(s)
+    default:
+      return url.QueryEscape(s)
+  }
+}
+
+/**
+ * Percent-encode bytes that may not appear in a URL
+ */
+func normalizeURL(s string) string {
+  var b strings.Builder
+  for i := 0; i < len(s); i++ {
+    c := s[i]
+    if isASCIILetter(c) || isASCIIDigit(c) || strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0 {
+      b.WriteByte(c)
+    }else{
+      fmt.Fprintf(&b, "%%%02X", c)
+    }
+  }
+  return b.String()
+}
+
+/**
+ * Escape a value for use in a script. In a string the value is escaped as
+ * string content, otherwise it is written as a JSON literal.
+ */
+func escapeJS(v interface{}, s string, state codeState) string {
+  if state != codeNormal {
+    return escapeJSString(s)
+  }
+  if _, ok := v.([]byte); ok {
+    v = s // don't encode bytes as base64
+  }
+  j, err := json.Marshal(v)
+  if err != nil {
+    return "null"
+  }
+  return " "+ string(j) +" " // pad to avoid merging with adjacent tokens
+}
+
+/**
+ * Escape content for use in a JS string
+ */
+func escapeJSString(s string) string {
+  var b strings.Builder
+  for _, r := range s {
+    switch r {
+      case '\n':
+        b.WriteString(`\n`)
+      case '\r':
+        b.WriteString(`\r`)
+      case '\t':
+        b.WriteString(`\t`)
+      case '\\', '\'', '"', '`', '<', '>', '&', '=', '+', '/', '\u2028', '\u2029':
+        fmt.Fprintf(&b, `\u%04x`, r)
+      default:
+        if r < 0x20 {
+          fmt.Fprintf(&b, `\u%04x`, r)
+        }else{
+          b.WriteRune(r)
+        }
+    }
+  }
+  return b.String()
+}
+
+/**
+ * Values which are safe to use outside of strings in CSS
+ */
+var safeCSSValue = regexp.MustCompile(`^[-\w\s#.,%!]*$`)
+
+/**
+ * Escape a value for use in a stylesheet. In a string the value is escaped
+ * as string content, otherwise it must be a simple value.
+ */
+func escapeCSS(s string, state codeState) string {
+  if state == codeNormal {
+    if !safeCSSValue.MatchString(s) {
+      return unsafeContent
+    }
+    return s
+  }
+  var b strings.Builder
+  for _, r := range s {
+    if r < 0x80 && !isASCIILetter(byte(r)) && !isASCIIDigit(byte(r)) && r != ' ' {
+      fmt.Fprintf(&b, `\%x `, r)
+    }else{
+      b.WriteRune(r)
+    }
+  }
+  return b.String()
+}
+
+/**
+ * Is a byte an ASCII letter
+ */
+func isASCIILetter(b byte) bool {
+  return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+/**
+ * Is a byte an ASCII digit
+ */
+func isASCIIDigit(b byte) bool {
+  return b >= '0' && b <= '9'
+}
+
+/**
+ * Is a byte HTML whitespace
+ */
+func isHTMLSpace(b byte) bool {
+  return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
@@ -0,0 +1,125 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test contextual escaping
+ */
+func TestEscapeHTML(t *testing.T) {
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `<b>"Tom" & 'Jerry'</b>`},
+    `<p>@(a)</p>`,
+    `<p>&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;</p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeNone}, true, true, map[string]interface{}{"a": `<b>Tom</b>`},
+    `<p>@(a)</p>`,
+    `<p><b>Tom</b></p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `"><script>`},
+    `<div title="@(a)" class=@(a)></div>`,
+    `<div title="&#34;&gt;&lt;script&gt;" class=&#34;&#62;&#60;script&#62;></div>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `javascript:alert(1)`, "b": `/search?q=<x y>`, "c": `https://example.com/`},
+    `<a href="@(a)">A</a><a href='@(b)'>B</a><a href="@(c)">C</a>`,
+    `<a href="#ZegoZ">A</a><a href='/search?q=%3Cx%20y%3E'>B</a><a href="https://example.com/">C</a>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `a&b c`},
+    `<a href="/search?q=@(a)">A</a>`,
+    `<a href="/search?q=a%26b+c">A</a>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `</script>`, "b": 123, "c": []int{1, 2}},
+    `<script>var a = @(a), b = @(b), c = @(c);</script><p>@(a)</p>`,
+    `<script>var a =  "\u003c/script\u003e" , b =  123 , c =  [1,2] ;</script><p>&lt;/script&gt;</p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `it's "quoted"`},
+    `<script>var a = '@(a)';</script><button onclick="f('@(a)')">`,
+    `<script>var a = 'it\u0027s \u0022quoted\u0022';</script><button onclick="f('it\u0027s \u0022quoted\u0022')">`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `red`, "b": `expression(alert(1))`},
+    `<p style="color: @(a)">A</p><p style="color: @(b)">B</p><style>p { color: @(a) }</style>`,
+    `<p style="color: red">A</p><p style="color: ZegoZ">B</p><style>p { color: red }</style>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `<b>`, "c": true},
+    `<!-- '@(a)' -->@if c {<p title='}@(a)@if c {'>}@(a)`,
+    `<!-- '&lt;b&gt;' --><p title='&lt;b&gt;'>&lt;b&gt;`,
+  )
+  
+}
+
+/**
+ * Test trusted content
+ */
+func TestEscapeTrusted(t *testing.T) {
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": `<b>Bold</b>`},
+    `<p>@(raw(a))</p><p>@(a)</p>`,
+    `<p><b>Bold</b></p><p>&lt;b&gt;Bold&lt;/b&gt;</p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": SafeHTML(`<a href="`), "b": `javascript:x()`},
+    `@(a)@(b)">`,
+    `<a href="#ZegoZ">`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": SafeURL(`javascript:x()`), "b": SafeJS(`alert("hi")`), "c": SafeCSS(`url(x.png)`)},
+    `<a href="@(a)" onclick="@(b)" style="background: @(c)"></a><script>@(b)</script><p>@(b)</p>`,
+    `<a href="javascript:x()" onclick="alert(&#34;hi&#34;)" style="background: url(x.png)"></a><script>alert("hi")</script><p>alert(&#34;hi&#34;)</p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": SafeHTML(`x" onmouseover="alert(1)`)},
+    `<p title="@(a)" class='@(a)'>@(a)</p>`,
+    `<p title="x&#34; onmouseover=&#34;alert(1)" class='x&#34; onmouseover=&#34;alert(1)'>x" onmouseover="alert(1)</p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, map[string]interface{}{"a": SafeHTML(`<b title="a > b">1 &lt; 2</b><!-- c --> & 3 < 4<br`)},
+    `<textarea>@(raw("<b>&amp;</b>"))</textarea><p title=@(a)>@(a)</p><p title="@(a)"></p>`,
+    `<textarea>&amp;</textarea><p title=1&#32;&lt;&#32;2&#32;&&#32;3&#32;&#60;&#32;4>`+
+    `<b title="a > b">1 &lt; 2</b><!-- c --> & 3 < 4<br</p><p title="1 &lt; 2 & 3 &lt; 4"></p>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{}, true, true, map[string]interface{}{"a": SafeHTML(`<b>`), "b": SafeURL(`/x`)},
+    `@(a)@(b)@(raw(1))`,
+    `<b>/x1`,
+  )
+  
+}
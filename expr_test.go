@@ -195,3 +195,513 @@ func TestFuncCall(t *testing.T) {
   )
   
 }
+
+/**
+ * Test conditional and null-coalescing expressions
+ */
+func TestConditional(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"active": true},
+    `class="@(active ? "on" : "off")"`,
+    `class="on"`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"active": false},
+    `class="@(active ? "on" : "off")"`,
+    `class="off"`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 5},
+    `@(a < 3 ? "small" : a < 10 ? "medium" : "large")`,
+    `medium`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": true, "b": false},
+    `@(a && b ? 1 : 2) @(a || b ? 1 : 2) @(a ? b ? 1 : 2 : 3)`,
+    `2 1 2`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": true, "f": func() int { panic("should not be called") }},
+    `@(a ? 1 : f())`,
+    `1`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": "yes"},
+    `@(a ? 1 : 2)`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": true},
+    `@(a ? 1)`,
+    ``,
+  )
+  
+  type user struct {
+    Name      string
+    Nickname  *string
+  }
+  compileAndRun(t, true, true, map[string]interface{}{"user": user{"Robert", nil}},
+    `@(user.Nickname ?? user.Name)`,
+    `Robert`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"user": map[string]interface{}{"Nickname": "Bobby"}, "f": func() int { panic("should not be called") }},
+    `@(user.Nickname ?? f())`,
+    `Bobby`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": nil, "b": nil, "c": ""},
+    `[@(a ?? b ?? c ?? "d")]`,
+    `[]`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": nil},
+    `@(a ?? false ? "yes" : "no")`,
+    `no`,
+  )
+  
+}
+
+/**
+ * Test safe navigation
+ */
+func TestSafeNavigation(t *testing.T) {
+  
+  type inner struct {
+    C string
+  }
+  type outer struct {
+    B *inner
+  }
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": &outer{&inner{"c"}}},
+    `@(a?.B?.C)`,
+    `c`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": &outer{nil}},
+    `[@(a?.B?.C)]`,
+    `[]`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": (*outer)(nil)},
+    `[@(a?.B.C)]`,
+    `[]`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": &outer{nil}},
+    `@(a.B.C)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": &outer{nil}},
+    `@(a?.B?.C ?? "none")`,
+    `none`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[string]interface{}{"b": []int{1, 2}}, "f": func() int { panic("should not be called") }},
+    `@(a?["b"]?[1]) [@(a["c"]?[f()])]`,
+    `2 []`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": nil},
+    `@(a[0])`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{NilDeref:true}, true, true, map[string]interface{}{"a": &outer{nil}, "b": nil},
+    `[@(a.B.C)][@(b[0])]`,
+    `[][]`,
+  )
+  
+}
+
+/**
+ * Test slice expressions
+ */
+func TestSlice(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3, 4}},
+    `@(a[1:3]) @(a[2:]) @(a[:1]) @(a[:]) @(len(a[4:]))`,
+    `[2 3] [3 4] [1] [1 2 3 4] 0`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": [3]string{"x", "y", "z"}, "n": 2},
+    `@(a[n-1:n+1]) @for v := range a[:n] {@(v)}`,
+    `[y z] xy`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": "héllo"},
+    `@(a[0]) @(a[3:]) @(a[:0])|`,
+    `h llo |`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{RuneStrings:true}, true, true, map[string]interface{}{"a": "héllo"},
+    `@(a[1]) @(a[2:]) @(a[1:3])`,
+    `é llo él`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[string]interface{}{"b": []int{1, 2, 3}}},
+    `@(a["b"][1:][0]) [@(a["c"]?[1:])]`,
+    `2 []`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@(a[2:4])`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@(a[2:1])`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": "abc"},
+    `@(a[3])`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": "abc"},
+    `@(a[1.5])`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{RuneStrings:true}, true, false, map[string]interface{}{"a": "abc"},
+    `@(a[1.5])`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": map[string]int{}},
+    `@(a[1:2])`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@(a[])`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test numeric arithmetic
+ */
+func TestNumeric(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `@(7 / 2) @(7.0 / 2) @(7 % 3) @(-7 / 2) @(7.5 % 2) @(1 + 0.5) @(3 * 4) @(0.5)`,
+    `3 3.5 1 -3 1.5 1.5 12 0.5`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"id": int64(9007199254740993), "u": uint64(18446744073709551614), "s": uint(2)},
+    `@(id + 2) @(u + 1) @(s - 3) @(id > 9007199254740992) @(u > id)`,
+    `9007199254740995 18446744073709551615 -1 true true`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"u": uint64(18446744073709551615), "n": -1, "m": int64(-9223372036854775808)},
+    `@(n + u) @(u + n) @(m + u) @(u - -n) @(u % n) @(u / -2)`,
+    `18446744073709551614 18446744073709551614 9223372036854775807 18446744073709551614 0 -9223372036854775807`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"u": uint64(18446744073709551615), "n": -1},
+    `@(n - u)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"u": uint64(18446744073709551615), "n": -1},
+    `@(u * n)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"f": func(a int8, b float64, c uint) string { return fmt.Sprint(a, b, c) }},
+    `@(f(1, 2, 3.0))`,
+    `1 2 3`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@i := 0;@for i < 3 {@i++}@(i / 2)`,
+    `1`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"f": func(a int8) int8 { return a }},
+    `@(f(300))`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"f": func(a int) int { return a }},
+    `@(f(1.5))`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(9223372036854775807 + 1)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(-9223372036854775807 - 2)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(4611686018427387904 * 2)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(1 / 0)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(1 % 0)`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test operator precedence
+ */
+func TestPrecedence(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `@(10 - 2 - 3) @(100 / 10 / 5) @(2 * 3 + 4 * 5) @(2 + 3 * 4 - 1) @(7 % 4 * 2) @(1 << 2 * 2) @(16 >> 1 >> 1)`,
+    `5 2 26 13 6 8 4`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": false, "b": false},
+    `@(!a && b) @(!a || b) @(!a == true) @(!(a || true))`,
+    `false true true false`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1, "b": 2, "c": 3},
+    `@(a < b && b < c) @(a + b == c) @((a < b) == true) @(a == 1 || b == 1 && c == 1)`,
+    `true true true true`,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": 1, "b": 2, "c": 3},
+    `@(a < b < c)`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": 1, "b": 2, "c": 3},
+    `@(a == b != c)`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test unary and bitwise operators
+ */
+func TestUnaryAndBitwise(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"x": 3, "a": []int{1, 2}},
+    `@(-1) @(-x) @(+x) @(2 - -x) @(-a[1]) @(-(x + 1)) @(- -x)`,
+    `-1 -3 3 5 -2 -4 3`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"x": 12, "y": 10},
+    `@(x & y) @(x ^ y) @(x &^ y) @(1 << 4) @(x >> 2)`,
+    `8 6 4 16 3`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"x": 6},
+    `@(1 + x & 3) @(x ^ 1 == 7) @(1 << 2 + 1)`,
+    `3 true 5`,
+  )
+  
+  // '|' is always a pipeline stage, never a bitwise or
+  compileAndRun(t, false, false, nil, `@(4 | 1)`, ``)
+  compileAndRun(t, false, false, map[string]interface{}{"x": 6, "y": 1}, `@(x | y == 7)`, ``)
+  compileAndRun(t, true, false, map[string]interface{}{"x": 6, "y": 1}, `@(x | y)`, ``)
+  
+  compileAndRun(t, true, false, nil,
+    `@(1.5 & 1)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(1 << -1)`,
+    ``,
+  )
+  
+  typeOf := func(v interface{}) string { return fmt.Sprintf("%T", v) }
+  compileAndRun(t, true, true, map[string]interface{}{"u": uint64(1 << 63 + 2), "n": -1, "s": uint8(3), "type": typeOf},
+    `@(u >> 1) @(u & 3) @(type(u & 3)) @(u ^ 1) @(u &^ 2) @(n & u) @(s << 4) @(type(s << 4)) @(type(3 & s)) @(-1 << 63) @(u >> 64) @(n >> 100)`,
+    `4611686018427387905 2 uint64 9223372036854775811 9223372036854775808 9223372036854775810 48 uint64 int64 -9223372036854775808 0 -1`,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(1 << 62 << 2)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@(1 << 63)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"u": uint64(1 << 63 + 2)},
+    `@(u << 1)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"u": uint64(1 << 63 + 2), "n": -1},
+    `@(n ^ u)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"s": "abc"},
+    `@(-s)`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test list and map literals
+ */
+func TestLiterals(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": 3},
+    `@([1, "two", n]) @([]) @(len(["a", "b",])) @(["a", "b"][1])`,
+    `[1 two 3] [] 2 b`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": 2},
+    `@({"a": 1, "b": n}["b"]) @(len({})) @(map{"k": [1, 2]}["k"][0])`,
+    `2 0 1`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for v := range ["a", "b", "c"] {@(v)}`,
+    `abc`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for k, v := range map{"b": 2, "a": 1} {@(k)=@(v) }`,
+    `a=1 b=2 `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for v := range [{"a": 1}, {"a": 2}] {@(v["a"])}`,
+    `12`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"f": func(v []interface{}, m map[string]interface{}) int { return len(v) + len(m) }},
+    `@(f([1, 2], {"a": 1}))`,
+    `3`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := {"a": 1}
+@y := [
+  "p",
+  "q",
+]
+@(x["a"])@(y[1])`,
+    "\n\n1q",
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": 1},
+    `@if n == 1 {@x := {"a": n}}else{no}@(n)`,
+    `1`,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@({1: "a"})`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@({"a": 1, "a": 2})`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@([1, 2)`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test pipes
+ */
+func TestPipe(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"name": "  Hello, World  "},
+    `[@(name | trim | upper)] [@(name | lower)]`,
+    `[HELLO, WORLD] [  hello, world  ]`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"name": "Élan vital"},
+    `@(name | upper | truncate(4))`,
+    `ÉLAN`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": nil, "b": "b"},
+    `@(a ?? b | upper) @(true || false | upper)`,
+    `B TRUE`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"join": func(a, b, c string) string { return a + b + c }},
+    `@("a" | join("b", "c"))`,
+    `abc`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@func wrap(v) {[@(v)]}@(a | len | wrap)`,
+    `[3]`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"a": "a"},
+    `@(a | missing)`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": "a"},
+    `@(a | "upper")`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test keywords which introduce statements used as identifiers
+ */
+func TestStatementKeywordIdentifiers(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"block": "B", "x": map[string]string{"block": "b", "extends": "e", "super": "s"}},
+    `@(block) @(x.block) @(x.extends) @(x["super"]) @if block == "B" {yes} @for _, v := range [block] {@(v)}`,
+    `B b e s yes B`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"include": true, "x": map[string]bool{"include": false}},
+    `@(include) @(x.include) @if include && !x.include {yes}`,
+    `true false yes`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"default": "d", "settings": map[string]string{"default": "a", "case": "b", "switch": "c", "fallthrough": "e"}},
+    `@(default) @(settings.default) @(settings.case) @(settings["switch"]) @(settings.fallthrough) @switch default { @case settings.default {no} @default {@(default)} }`,
+    `d a b c e d`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"func": "f", "x": map[string]string{"func": "g"}},
+    `@func f(func) {[@(func)]}@f(x.func)@(func)`,
+    `[g]f`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"capture": "c", "x": map[string]string{"capture": "d"}},
+    `@capture capture {@(x.capture)}@(capture)`,
+    `d`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"map": "m", "x": map[string]string{"map": "n"}},
+    `@(map) @(x.map) @(map{"a": map}["a"]) @(len(map))`,
+    `m n m 1`,
+  )
+  
+}
@@ -0,0 +1,108 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test layout inheritance
+ */
+func TestExtends(t *testing.T) {
+  loader := NewMapLoader(map[string]string{
+    "base.ego":   `<html>@block title {Base}|@block content {Nothing}|@block footer {Footer}</html>`,
+    "layout.ego": `@extends("base.ego")@block title {Layout/@super()}@block content {<main>@super()</main>}`,
+    "header.ego": `@block title {Header}`,
+    "self.ego":   `@extends("self.ego")`,
+  })
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, nil,
+    `@block title {Title}`,
+    `Title`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, map[string]interface{}{"name": "Page"},
+    `@extends("base.ego") This is ignored. @block content {@(name)}`,
+    `<html>Base|Page|Footer</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, nil,
+    `@extends("base.ego")@block content {Before @super() after}`,
+    `<html>Base|Before Nothing after|Footer</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, nil,
+    `@extends("layout.ego")@block title {Page/@super()}@block footer {@block inner {Inner}}`,
+    `<html>Page/Layout/Base|<main>Nothing</main>|Inner</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, nil,
+    `@extends("base.ego")@block title {@include("header.ego")}`,
+    `<html>Header|Nothing|Footer</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, map[string]interface{}{"name": "Page"},
+    "@extends(\"base.ego\")\n@func card(t) {[@(t)]}\n@title := \"T\"\n@capture c {@(name)}\n@title = \"T!\"\n@block content {@card(title)@(c)}",
+    `<html>Base|[T!]Page|Footer</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, nil,
+    `@layout := "base.ego";@extends(layout)@if true {ignored}@block title {@(layout)}`,
+    `<html>base.ego|Nothing|Footer</html>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, false, nil,
+    `@extends("self.ego")`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, false, false, nil,
+    `@extends("base.ego")@extends("layout.ego")`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, false, false, nil,
+    `@if true {@extends("base.ego")}`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, false, false, nil,
+    `@block a {A}@block a {B}`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, false, false, nil,
+    `@super()`,
+    ``,
+  )
+  
+}
@@ -31,7 +31,9 @@
 package ego
 
 import (
+  "iter"
   "testing"
+  "github.com/stretchr/testify/assert"
 )
 
 /**
@@ -69,10 +71,342 @@ func TestFor(t *testing.T) {
     ``,
   )
   
-  // this one is hard to test since the keys are not necessarily iterated in any particular order
-  // compileAndRun(t, true, true, map[string]interface{}{"a": map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}},
-  //   `@for k, v := range a { @(k) = @(v) }`,
-  //   ` a = 1  b = 2  c = 3  d = 4 `,
-  // )
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}},
+    `@for k, v := range a { @(k) = @(v) }`,
+    ` a = 1  b = 2  c = 3  d = 4 `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[int]string{10: "a", -2: "b", 3: "c"}},
+    `@for k, v := range a {@(k)=@(v) }`,
+    `-2=b 3=c 10=a `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[interface{}]int{"b": 1, 2.5: 2, true: 3, nil: 4, uint(1): 5, "a": 6, false: 7}},
+    `@for k, v := range a {@(k)=@(v) }`,
+    `=4 false=7 true=3 1=5 2.5=2 a=6 b=1 `,
+  )
+  
+}
+
+/**
+ * Test for loops with clauses
+ */
+func TestForClause(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := 0; i < 5; i++ {@(i)}`,
+    `01234`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": 3},
+    `@for i := 0; i < n; i += 1 {@(i)}`,
+    `012`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := 10; i > 0; i-- {@(i) @if i < 8 {@break;}}`,
+    `10 9 8 7 `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := 0; i < 5; i++ {@if i == 2 {@continue;}@(i)}`,
+    `0134`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := 0;@for x < 3 {@(x) @x++;}`,
+    `0 1 2 `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := 0;@for {@x++;@if x > 3 {@break;}}@(x)`,
+    `4`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := 0;@for ; x < 2; {@(x) @x++;}`,
+    `0 1 `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2}},
+    `@for i := 0; i < 2; i++ {@for _, e := range a {@break;}@(i)}`,
+    `01`,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@break;`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@for a, b {}`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{MaxIterations:100}, true, false, nil,
+    `@for {}`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{MaxIterations:3}, true, false, map[string]interface{}{"a": []int{1, 2, 3, 4}},
+    `@for _, e := range a {@(e)}`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test ranging over other iterable types
+ */
+func TestForRange(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := range 5 {@(i)}`,
+    `01234`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": uint64(3)},
+    `@for i := range n {@(i)}`,
+    `012`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"n": uint64(1 << 63)},
+    `@for i := range n {@(i)}`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"n": uint8(3)},
+    `@for i, e := range n {@(i)=@(e) }`,
+    `0=0 1=1 2=2 `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := range 0 {@(i)}`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@for i := range 1.5 {@(i)}`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for c := range "héllo" {@(c).}`,
+    `h.é.l.l.o.`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i, c := range "héllo" {@(i)=@(c) }`,
+    `0=h 1=é 3=l 4=l 5=o `,
+  )
+  
+  c := make(chan int, 3)
+  c <- 1; c <- 2; c <- 3
+  close(c)
+  compileAndRun(t, true, true, map[string]interface{}{"c": (<-chan int)(c)},
+    `@for e := range c {@(e)}`,
+    `123`,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"c": make(chan<- int)},
+    `@for e := range c {@(e)}`,
+    ``,
+  )
+  
+  var seq iter.Seq[string] = func(yield func(string) bool) {
+    for _, e := range []string{"a", "b", "c"} {
+      if !yield(e) {
+        return
+      }
+    }
+  }
+  
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq},
+    `@for e := range s {@(e)}`,
+    `abc`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq},
+    `@for e := range s {@(e) @if e == "b" {@break;}}`,
+    `a b `,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"s": seq},
+    `@for i, e := range s {@(i)=@(e) }`,
+    ``,
+  )
+  
+  var seq2 iter.Seq2[string, int] = func(yield func(string, int) bool) {
+    for i, e := range []string{"a", "b", "c"} {
+      if !yield(e, i * 10) {
+        return
+      }
+    }
+  }
+  
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq2},
+    `@for k, v := range s {@(k)=@(v) }`,
+    `a=0 b=10 c=20 `,
+  )
+  
+  compileAndRun(t, true, false, map[string]interface{}{"s": seq2, "f": func(){}},
+    `@for k, v := range f {@(k)=@(v) }`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test else clauses on loops
+ */
+func TestForElse(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2}},
+    `@for _, e := range a {@(e)}else{ None }`,
+    `12`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{}},
+    `@for _, e := range a {@(e)}else{ None }`,
+    ` None `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": nil},
+    `@for _, e := range a { @(e) }
+     else { None }`,
+    ` None `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[string]int{}},
+    `@for k, v := range a {@(k)}else{ None }`,
+    ` None `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2}},
+    `@for _, e := range a {@break;}else{ None }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": []int{}, "b": true},
+    `@for _, e := range a {@(e)}else if b { B }else{ None }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": []int{}, "b": []int{1}},
+    `@for _, e := range a {@(e)}else for _, e := range b {@(e)}`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := 0; i < 0; i++ {@(i)}else{ None }`,
+    ` None `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := 0; i < 2; i++ {@(i)}else{ None }`,
+    `01`,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": []int{}},
+    `@for _, e := range a {@(e)}else{@break;}`,
+    ``,
+  )
+  
+}
+
+/**
+ * Test loop metadata
+ */
+func TestForLoopMetadata(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []string{"a", "b", "c"}},
+    `@for _, e, l := range a {@(e)@if !l.Last {, }}`,
+    `a, b, c`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []string{"a", "b", "c"}},
+    `@for _, e, loop := range a {@(loop.Index)/@(loop.Index1)/@(loop.Length)@if loop.First {F}@if loop.Even {E}@if loop.Odd {O} }`,
+    `0/1/3FE 1/2/3O 2/3/3E `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": map[string]int{"x": 1, "y": 2}},
+    `@for k, v, l := range a {@(k)@if l.Last {.}}`,
+    `xy.`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i, _, o := range 2 {@for j, _, l := range 2 {@(l.Parent.Index)@(l.Index) }}`,
+    `00 01 10 11 `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for i := range 2 {@for j, _, l := range 2 {@(l.Parent.Index)@(l.Index)@if l.Parent.Last {.} }}`,
+    `00 01 10. 11. `,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@for _, c, l := range "héé" {@(c)@if l.Last {!}}`,
+    `héé!`,
+  )
+  
+  // the metadata is only bound when it is requested
+  compileAndRun(t, true, true, map[string]interface{}{"a": []string{"a", "b"}, "loop": "x"},
+    `@for _, e := range a {@(e)@(loop)}`,
+    `axbx`,
+  )
+  
+  compileAndRun(t, false, false, nil, `@for a, b, c, d := range 2 {}`, ``)
+  
+  c := make(chan int, 3)
+  c <- 1; c <- 2; c <- 3
+  close(c)
+  compileAndRun(t, true, true, map[string]interface{}{"c": c},
+    `@for _, e, l := range c {@(e)@(l.Length)@if l.Last {.} }`,
+    `1-1 2-1 3-1. `,
+  )
+  
+  c = make(chan int, 3)
+  c <- 1; c <- 2; c <- 3
+  close(c)
+  compileAndRun(t, true, false, map[string]interface{}{"c": c}, `@for k, e, l := range c {}`, ``)
+  
+  // without a reference to Last no value is received ahead of the body
+  c = make(chan int, 3)
+  c <- 1; c <- 2; c <- 3
+  close(c)
+  compileAndRun(t, true, true, map[string]interface{}{"c": c},
+    `@for _, e, l := range c {@(e)@if l.Index == 0 {@break;} }`,
+    `1`,
+  )
+  assert.Equal(t, 2, len(c))
+  
+  var produced int
+  var seq iter.Seq[string] = func(yield func(string) bool) {
+    for _, e := range []string{"a", "b", "c"} {
+      produced++
+      if !yield(e) {
+        return
+      }
+    }
+  }
+  
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq},
+    `@for _, e, l := range s {@(l.Index)@(e)@if l.Last {.} }`,
+    `0a 1b 2c. `,
+  )
+  
+  produced = 0
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq},
+    `@for _, e, l := range s {@(e)@if l.Index == 1 {@break;} }`,
+    `a b`,
+  )
+  assert.Equal(t, 2, produced)
+  
+  produced = 0
+  compileAndRun(t, true, true, map[string]interface{}{"s": seq},
+    `@for _, e, l := range s {@(e)@if l.Last {.}else if l.Index == 1 {@break;} }`,
+    `a b`,
+  )
+  assert.Equal(t, 3, produced)
   
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test template functions
+ */
+func TestFunc(t *testing.T) {
+  
+  compileAndRun(t, true, true, nil,
+    `@func field(name, label) {<label for="@(name)">@(label)</label>}@field("email", "Email") and @field("name", "Name").`,
+    `<label for="email">Email</label> and <label for="name">Name</label>.`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []string{"x", "y"}},
+    `@func item(v) {[@(v)]}@for _, e := range a {@item(e)}`,
+    `[x][y]`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"prefix": "#"},
+    `@func tag(v) {@(prefix)@(v)}@tag("a")`,
+    `#a`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := "outer";@func show() {@(x)}@x = "changed";@show()`,
+    `changed`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@func count(n) {@if n > 0 {@count(n - 1)}@(n)}@count(3)`,
+    `0123`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@func hello() {Hello}@(hello())!`,
+    `Hello!`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@func item(v) {@(v)}@for i := 0; i < 3; i++ {@item(i)}`,
+    `012`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@(len(a)) @len(a)`,
+    `3 3`,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@func f(a, b) {}@f(1)`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@func f() {@f()}@f()`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, map[string]interface{}{"a": []int{1}},
+    `@for _, e := range a {@func f() {@break;}}`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Escape:EscapeHTML}, true, true, nil,
+    `@func link(url, text) {<a href="@(url)">@(text)</a>}@link("/a?b=c&d", "<b>")`,
+    `<a href="/a?b=c&amp;d">&lt;b&gt;</a>`,
+  )
+  
+}
@@ -74,5 +74,15 @@ func TestIf(t *testing.T) {
     ` A }  }`,
   )
   
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1, "b": uint8(1), "c": []int{1}},
+    `@if a == 1 && b == a && c != c { A }else{ B }`, // numbers of different types compare by value, slices are never equal
+    ` A `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1, "b": "1"},
+    `@if a == 1 && a != b { A }else{ B }`,
+    ` A `,
+  )
+  
 }
 
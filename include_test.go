@@ -0,0 +1,145 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "strings"
+  "testing"
+  "testing/fstest"
+)
+
+import (
+  "github.com/stretchr/testify/assert"
+)
+
+/**
+ * Test includes
+ */
+func TestInclude(t *testing.T) {
+  loader := NewMapLoader(map[string]string{
+    "header.ego": `<h1>@(title)</h1>`,
+    "item.ego":   `[@(name)]`,
+    "a.ego":      `A @include("b.ego")`,
+    "b.ego":      `B @include("a.ego")`,
+    "bad.ego":    `@(`,
+  })
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, map[string]interface{}{"title": "Hello"},
+    `@include("header.ego") and more`,
+    `<h1>Hello</h1> and more`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, true, map[string]interface{}{"items": []map[string]string{{"name": "a"}, {"name": "b"}}},
+    `@for _, e := range items {@include("item.ego", e)}`,
+    `[a][b]`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader, Escape:EscapeHTML}, true, true, map[string]interface{}{"title": "<Hello>"},
+    `<title>@include("header.ego")</title>`,
+    `<title><h1>&lt;Hello&gt;</h1></title>`,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, false, false, nil,
+    `@include("header.ego", a, b)`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{}, true, false, nil,
+    `@include("header.ego")`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, false, nil,
+    `@include("missing.ego")`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:loader}, true, false, nil,
+    `@include("bad.ego")`,
+    ``,
+  )
+  
+  compileAndRunRuntime(t, &Runtime{Loader:&FSLoader{FS:fstest.MapFS{"dir/x.ego": &fstest.MapFile{Data:[]byte(`X=@(x)`)}}}}, true, true, map[string]interface{}{"x": 1},
+    `@include("dir/x.ego")!`,
+    `X=1!`,
+  )
+  
+}
+
+/**
+ * Test include cycles
+ */
+func TestIncludeCycle(t *testing.T) {
+  loader := NewMapLoader(map[string]string{
+    "a.ego": `A @include("b.ego")`,
+    "b.ego": `B @include("a.ego")`,
+  })
+  
+  prog, err := Compile(`@include("a.ego")`)
+  if !assert.Nil(t, err) { return }
+  
+  err = prog.Exec(&Runtime{Stdout:&strings.Builder{}, Loader:loader}, nil)
+  if assert.NotNil(t, err) {
+    assert.Contains(t, err.Error(), "Include cycle: a.ego -> b.ego -> a.ego")
+    if r, ok := err.(*runtimeError); assert.True(t, ok) {
+      assert.Equal(t, `include("a.ego")`, r.span.excerpt())
+    }
+  }
+  
+}
+
+/**
+ * Test that loaders cache compiled templates
+ */
+func TestLoaderCache(t *testing.T) {
+  loader := NewMapLoader(map[string]string{
+    "a.ego": `A`,
+  })
+  
+  a, err := loader.Load("a.ego")
+  if !assert.Nil(t, err) { return }
+  
+  loader.Sources["a.ego"] = `B` // the cached program is used
+  b, err := loader.Load("a.ego")
+  if !assert.Nil(t, err) { return }
+  assert.True(t, a == b)
+  
+  _, err = loader.Load("missing.ego")
+  assert.NotNil(t, err)
+  
+  fsl := &FSLoader{FS:fstest.MapFS{"x.ego": &fstest.MapFile{Data:[]byte(`X`)}}}
+  x, err := fsl.Load("x.ego")
+  if !assert.Nil(t, err) { return }
+  y, err := fsl.Load("/x.ego")
+  if !assert.Nil(t, err) { return }
+  assert.True(t, x == y)
+  
+}
@@ -0,0 +1,142 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "os"
+  "sync"
+  "io/fs"
+  "strings"
+)
+
+/**
+ * A template loader resolves the names used by statements like @include
+ */
+type Loader interface {
+  Load(name string)(*Program, error)
+}
+
+/**
+ * A loader which reads and compiles templates from a filesystem. This can be
+ * used with os.DirFS, embed.FS or any other fs.FS implementation. Templates
+ * are compiled the first time they are loaded and cached by name, so changes
+ * to them are not seen; use a Set with Reload enabled during development.
+ */
+type FSLoader struct {
+  FS      fs.FS
+  Options Options // options used to compile templates
+  cache   programCache
+}
+
+/**
+ * Create a loader which reads templates from a directory
+ */
+func NewFileLoader(root string) *FSLoader {
+  return &FSLoader{FS:os.DirFS(root)}
+}
+
+/**
+ * Load a template
+ */
+func (l *FSLoader) Load(name string) (*Program, error) {
+  name = strings.TrimPrefix(name, "/")
+  return l.cache.load(name, func() (*Program, error) {
+    data, err := fs.ReadFile(l.FS, name)
+    if err != nil {
+      return nil, err
+    }
+    return CompileWithOptions(string(data), l.Options)
+  })
+}
+
+/**
+ * A loader which compiles templates from sources in memory, keyed by name.
+ * Templates are compiled the first time they are loaded and cached by name.
+ */
+type MapLoader struct {
+  Sources map[string]string
+  Options Options // options used to compile templates
+  cache   programCache
+}
+
+/**
+ * Create a loader which compiles templates from the provided sources
+ */
+func NewMapLoader(sources map[string]string) *MapLoader {
+  return &MapLoader{Sources:sources}
+}
+
+/**
+ * Load a template
+ */
+func (l *MapLoader) Load(name string) (*Program, error) {
+  return l.cache.load(name, func() (*Program, error) {
+    src, ok := l.Sources[name]
+    if !ok {
+      return nil, &fs.PathError{Op:"load", Path:name, Err:fs.ErrNotExist}
+    }
+    return CompileWithOptions(src, l.Options)
+  })
+}
+
+/**
+ * Compiled programs, keyed by name. A cache is safe for concurrent use.
+ */
+type programCache struct {
+  lock      sync.Mutex
+  programs  map[string]*Program
+}
+
+/**
+ * Obtain the program for a name, compiling it if it isn't cached. Errors are
+ * not cached.
+ */
+func (c *programCache) load(name string, compile func() (*Program, error)) (*Program, error) {
+  c.lock.Lock()
+  prog, ok := c.programs[name]
+  c.lock.Unlock()
+  if ok {
+    return prog, nil
+  }
+  
+  prog, err := compile()
+  if err != nil {
+    return nil, err
+  }
+  
+  c.lock.Lock()
+  defer c.lock.Unlock()
+  if c.programs == nil {
+    c.programs = make(map[string]*Program)
+  }
+  c.programs[name] = prog
+  return prog, nil
+}
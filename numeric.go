@@ -0,0 +1,422 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "fmt"
+  "math"
+  "math/big"
+  "reflect"
+)
+
+var (
+  errIntegerOverflow  = fmt.Errorf("Integer overflow")
+  errDivisionByZero   = fmt.Errorf("Integer division by zero")
+  errNegativeShift    = fmt.Errorf("Negative shift count")
+)
+
+/**
+ * Perform an arithmetic operation on numeric values. Integers are kept as
+ * int64 or uint64 when both operands are integers; the result is only a
+ * float if either operand is. Integer operations which overflow produce an
+ * error rather than wrapping.
+ */
+func arithmetic(op tokenType, a, b reflect.Value) (interface{}, error) {
+  switch {
+    
+    case isSignedKind(a.Kind()) && isSignedKind(b.Kind()):
+      return signedArithmetic(op, a.Int(), b.Int())
+      
+    case isUnsignedKind(a.Kind()) && isUnsignedKind(b.Kind()):
+      return unsignedArithmetic(op, a.Uint(), b.Uint())
+      
+    case isSignedKind(a.Kind()) && isUnsignedKind(b.Kind()):
+      if b.Uint() <= math.MaxInt64 {
+        return signedArithmetic(op, a.Int(), int64(b.Uint()))
+      }else if a.Int() >= 0 {
+        return unsignedArithmetic(op, uint64(a.Int()), b.Uint())
+      }else{
+        return mixedArithmetic(op, big.NewInt(a.Int()), new(big.Int).SetUint64(b.Uint()))
+      }
+      
+    case isUnsignedKind(a.Kind()) && isSignedKind(b.Kind()):
+      if a.Uint() <= math.MaxInt64 {
+        return signedArithmetic(op, int64(a.Uint()), b.Int())
+      }else if b.Int() >= 0 {
+        return unsignedArithmetic(op, a.Uint(), uint64(b.Int()))
+      }else{
+        return mixedArithmetic(op, new(big.Int).SetUint64(a.Uint()), big.NewInt(b.Int()))
+      }
+      
+  }
+  return floatArithmetic(op, numberAsFloat(a), numberAsFloat(b))
+}
+
+/**
+ * Perform an arithmetic operation on signed integers
+ */
+func signedArithmetic(op tokenType, a, b int64) (interface{}, error) {
+  switch op {
+    case tokenAdd:
+      if (b > 0 && a > math.MaxInt64 - b) || (b < 0 && a < math.MinInt64 - b) {
+        return nil, errIntegerOverflow
+      }
+      return a + b, nil
+    case tokenSub:
+      if (b < 0 && a > math.MaxInt64 + b) || (b > 0 && a < math.MinInt64 + b) {
+        return nil, errIntegerOverflow
+      }
+      return a - b, nil
+    case tokenMul:
+      if a == 0 || b == 0 {
+        return int64(0), nil
+      }
+      r := a * b
+      if r / b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+        return nil, errIntegerOverflow
+      }
+      return r, nil
+    case tokenDiv:
+      if b == 0 {
+        return nil, errDivisionByZero
+      }else if a == math.MinInt64 && b == -1 {
+        return nil, errIntegerOverflow
+      }
+      return a / b, nil
+    case tokenMod:
+      if b == 0 {
+        return nil, errDivisionByZero
+      }else if b == -1 {
+        return int64(0), nil
+      }
+      return a % b, nil
+    default:
+      return nil, fmt.Errorf("Invalid operator: %v", op)
+  }
+}
+
+/**
+ * Perform an arithmetic operation on unsigned integers. Subtraction which
+ * produces a negative result is signed, if the result can be represented.
+ */
+func unsignedArithmetic(op tokenType, a, b uint64) (interface{}, error) {
+  switch op {
+    case tokenAdd:
+      if a > math.MaxUint64 - b {
+        return nil, errIntegerOverflow
+      }
+      return a + b, nil
+    case tokenSub:
+      if b <= a {
+        return a - b, nil
+      }else if d := b - a; d <= 1 << 63 {
+        return -int64(d - 1) - 1, nil
+      }
+      return nil, errIntegerOverflow
+    case tokenMul:
+      if a == 0 || b == 0 {
+        return uint64(0), nil
+      }
+      r := a * b
+      if r / b != a {
+        return nil, errIntegerOverflow
+      }
+      return r, nil
+    case tokenDiv:
+      if b == 0 {
+        return nil, errDivisionByZero
+      }
+      return a / b, nil
+    case tokenMod:
+      if b == 0 {
+        return nil, errDivisionByZero
+      }
+      return a % b, nil
+    default:
+      return nil, fmt.Errorf("Invalid operator: %v", op)
+  }
+}
+
+/**
+ * Perform an arithmetic operation on integers which don't share a type, a
+ * negative int64 and a uint64 too large to be signed. The exact result must
+ * itself be representable as either an int64 or a uint64.
+ */
+func mixedArithmetic(op tokenType, a, b *big.Int) (interface{}, error) {
+  var r big.Int
+  switch op {
+    case tokenAdd:
+      r.Add(a, b)
+    case tokenSub:
+      r.Sub(a, b)
+    case tokenMul:
+      r.Mul(a, b)
+    case tokenDiv, tokenMod:
+      if b.Sign() == 0 {
+        return nil, errDivisionByZero
+      }else if op == tokenDiv {
+        r.Quo(a, b) // truncated, as in Go
+      }else{
+        r.Rem(a, b)
+      }
+    default:
+      return nil, fmt.Errorf("Invalid operator: %v", op)
+  }
+  if r.IsInt64() {
+    return r.Int64(), nil
+  }else if r.IsUint64() {
+    return r.Uint64(), nil
+  }
+  return nil, errIntegerOverflow
+}
+
+/**
+ * Perform a bitwise operation on integer values. As with arithmetic, integers
+ * are kept as int64 or uint64, and the result of a shift has the type of its
+ * left operand. A left shift which overflows produces an error.
+ */
+func bitwise(op tokenType, a, b reflect.Value) (interface{}, error) {
+  if op == tokenShiftLeft || op == tokenShiftRight {
+    var n uint64
+    if isSignedKind(b.Kind()) {
+      if b.Int() < 0 {
+        return nil, errNegativeShift
+      }
+      n = uint64(b.Int())
+    }else{
+      n = b.Uint()
+    }
+    if isSignedKind(a.Kind()) {
+      return signedShift(op, a.Int(), n)
+    }else{
+      return unsignedShift(op, a.Uint(), n)
+    }
+  }
+  
+  switch {
+    
+    case isSignedKind(a.Kind()) && isSignedKind(b.Kind()):
+      return bigBitwise(op, big.NewInt(a.Int()), big.NewInt(b.Int()), true)
+      
+    case isUnsignedKind(a.Kind()) && isUnsignedKind(b.Kind()):
+      return bigBitwise(op, new(big.Int).SetUint64(a.Uint()), new(big.Int).SetUint64(b.Uint()), false)
+      
+    case isSignedKind(a.Kind()):
+      return bigBitwise(op, big.NewInt(a.Int()), new(big.Int).SetUint64(b.Uint()), b.Uint() <= math.MaxInt64)
+      
+    default:
+      return bigBitwise(op, new(big.Int).SetUint64(a.Uint()), big.NewInt(b.Int()), a.Uint() <= math.MaxInt64)
+      
+  }
+}
+
+/**
+ * Perform a bitwise operation on integers in two's complement. The result is
+ * an int64 if the operands are signed, or a uint64 otherwise, when it can be
+ * represented as one.
+ */
+func bigBitwise(op tokenType, a, b *big.Int, signed bool) (interface{}, error) {
+  var r big.Int
+  switch op {
+    case tokenAmp:
+      r.And(a, b)
+    case tokenCaret:
+      r.Xor(a, b)
+    case tokenAndNot:
+      r.AndNot(a, b)
+    default:
+      return nil, fmt.Errorf("Invalid operator: %v", op)
+  }
+  if r.IsInt64() && (signed || r.Sign() < 0) {
+    return r.Int64(), nil
+  }else if r.IsUint64() {
+    return r.Uint64(), nil
+  }
+  return nil, errIntegerOverflow
+}
+
+/**
+ * Shift a signed integer
+ */
+func signedShift(op tokenType, a int64, n uint64) (interface{}, error) {
+  if op == tokenShiftRight {
+    return a >> min(n, 63), nil
+  }
+  if a == 0 {
+    return int64(0), nil
+  }else if n > 63 || (a << n) >> n != a {
+    return nil, errIntegerOverflow
+  }
+  return a << n, nil
+}
+
+/**
+ * Shift an unsigned integer
+ */
+func unsignedShift(op tokenType, a uint64, n uint64) (interface{}, error) {
+  if op == tokenShiftRight {
+    if n > 63 {
+      return uint64(0), nil
+    }
+    return a >> n, nil
+  }
+  if a == 0 {
+    return uint64(0), nil
+  }else if n > 63 || (a << n) >> n != a {
+    return nil, errIntegerOverflow
+  }
+  return a << n, nil
+}
+
+/**
+ * Perform an arithmetic operation on floats
+ */
+func floatArithmetic(op tokenType, a, b float64) (interface{}, error) {
+  switch op {
+    case tokenAdd:
+      return a + b, nil
+    case tokenSub:
+      return a - b, nil
+    case tokenMul:
+      return a * b, nil
+    case tokenDiv:
+      return a / b, nil
+    case tokenMod:
+      return math.Mod(a, b), nil
+    default:
+      return nil, fmt.Errorf("Invalid operator: %v", op)
+  }
+}
+
+/**
+ * Negate a numeric value
+ */
+func negate(v reflect.Value) (interface{}, error) {
+  switch {
+    case isSignedKind(v.Kind()):
+      if v.Int() == math.MinInt64 {
+        return nil, errIntegerOverflow
+      }
+      return -v.Int(), nil
+    case isUnsignedKind(v.Kind()):
+      return unsignedArithmetic(tokenSub, 0, v.Uint())
+    default:
+      return -v.Float(), nil
+  }
+}
+
+/**
+ * Normalize a numeric value to int64, uint64 or float64
+ */
+func normalizeNumber(v reflect.Value) interface{} {
+  switch {
+    case isSignedKind(v.Kind()):
+      return v.Int()
+    case isUnsignedKind(v.Kind()):
+      return v.Uint()
+    default:
+      return v.Float()
+  }
+}
+
+/**
+ * Compare numeric values for an ordering operator. Comparisons which involve
+ * NaN are false, as they are in Go.
+ */
+func compareOrder(op tokenType, a, b reflect.Value) (bool, error) {
+  if fa, fb := numberAsFloat(a), numberAsFloat(b); math.IsNaN(fa) || math.IsNaN(fb) {
+    return false, nil
+  }
+  c := compareNumbers(a, b)
+  switch op {
+    case tokenLess:
+      return c < 0, nil
+    case tokenGreater:
+      return c > 0, nil
+    case tokenLessEqual:
+      return c <= 0, nil
+    case tokenGreaterEqual:
+      return c >= 0, nil
+    default:
+      return false, fmt.Errorf("Invalid operator: %v", op)
+  }
+}
+
+/**
+ * Convert a numeric value to another numeric type, if it can be represented
+ * exactly in that type. Floats may be converted to integers if they have no
+ * fractional part.
+ */
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+  if !isNumericKind(v.Kind()) || !isNumericKind(t.Kind()) {
+    return reflect.Value{}, false
+  }
+  
+  z := reflect.New(t).Elem()
+  switch {
+    case isSignedKind(t.Kind()):
+      switch {
+        case isSignedKind(v.Kind()):
+          if z.OverflowInt(v.Int()) {
+            return reflect.Value{}, false
+          }
+        case isUnsignedKind(v.Kind()):
+          if v.Uint() > math.MaxInt64 || z.OverflowInt(int64(v.Uint())) {
+            return reflect.Value{}, false
+          }
+        default:
+          if f := v.Float(); f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || z.OverflowInt(int64(f)) {
+            return reflect.Value{}, false
+          }
+      }
+    case isUnsignedKind(t.Kind()):
+      switch {
+        case isSignedKind(v.Kind()):
+          if v.Int() < 0 || z.OverflowUint(uint64(v.Int())) {
+            return reflect.Value{}, false
+          }
+        case isUnsignedKind(v.Kind()):
+          if z.OverflowUint(v.Uint()) {
+            return reflect.Value{}, false
+          }
+        default:
+          if f := v.Float(); f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || z.OverflowUint(uint64(f)) {
+            return reflect.Value{}, false
+          }
+      }
+    default:
+      if z.OverflowFloat(numberAsFloat(v)) {
+        return reflect.Value{}, false
+      }
+  }
+  
+  return v.Convert(t), true
+}
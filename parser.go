@@ -32,6 +32,8 @@ package ego
 
 import (
   "fmt"
+  "math/big"
+  "strings"
 )
 
 /**
@@ -40,13 +42,69 @@ import (
 type parser struct {
   scanner   *scanner
   la        []token
+  blocks    map[string]*blockNode // named blocks declared in the program
+  nblock    int                   // named block depth
+  scopes    []map[string]struct{} // variables declared in each enclosing scope
+  nloop     int                   // loop depth
+  ranges    []*rangeScope         // range loops being parsed, innermost last
+  nswitch   int                   // switch depth
+  depth     int                   // block depth
+  ncase     int                   // block depth of the innermost case body
+  fallthru  bool                  // the innermost case body ends with fallthrough
+}
+
+/**
+ * A range loop being parsed
+ */
+type rangeScope struct {
+  ident string // the variable bound to the loop metadata, if any
+  last  bool   // the body refers to the Last field of the loop metadata
 }
 
 /**
  * Create a parser
  */
 func newParser(s *scanner) *parser {
-  return &parser{s, make([]token, 0, 2)}
+  return &parser{s, make([]token, 0, 2), make(map[string]*blockNode), 0, nil, 0, nil, 0, 0, 0, false}
+}
+
+/**
+ * Push a scope
+ */
+func (p *parser) pushScope() {
+  p.scopes = append(p.scopes, make(map[string]struct{}))
+}
+
+/**
+ * Pop a scope, returning true if any variables were declared in it
+ */
+func (p *parser) popScope() bool {
+  l := len(p.scopes)
+  d := len(p.scopes[l-1]) > 0
+  p.scopes = p.scopes[:l-1]
+  return d
+}
+
+/**
+ * Declare a variable in the current scope
+ */
+func (p *parser) declare(name string) {
+  p.scopes[len(p.scopes)-1][name] = struct{}{}
+}
+
+/**
+ * Determine if a variable is declared in the current scope or, if the
+ * parameter local is false, any enclosing scope
+ */
+func (p *parser) declared(name string, local bool) bool {
+  for i := len(p.scopes) - 1; i >= 0; i-- {
+    if _, ok := p.scopes[i][name]; ok {
+      return true
+    }else if local {
+      break
+    }
+  }
+  return false
 }
 
 /**
@@ -112,6 +170,7 @@ func (p *parser) nextAssert(valid ...tokenType) (token, error) {
  */
 func (p *parser) parse() (*Program, error) {
   prog := &Program{}
+  p.pushScope()
   
   for {
     t := p.next()
@@ -121,6 +180,8 @@ func (p *parser) parse() (*Program, error) {
     switch t.which {
       
       case tokenEOF:
+        prog.blocks = p.blocks
+        prog.scoped = p.popScope()
         return prog, nil
         
       case tokenError:
@@ -132,6 +193,11 @@ func (p *parser) parse() (*Program, error) {
       case tokenMeta:
         if n, err := p.parseMeta(t); err != nil {
           return nil, err
+        }else if e, ok := n.(*extendsNode); ok {
+          if prog.extends != nil {
+            return nil, &parserError{"A template may only extend one parent", e.span, nil}
+          }
+          prog.extends = e
         }else{
           prog.add(n)
         }
@@ -174,6 +240,48 @@ func (p *parser) parseMeta(t token) (executable, error) {
         return n, nil
       }
       
+    case tokenSwitch:
+      if n, err := p.parseSwitch(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenFallthrough:
+      if n, err := p.parseFallthrough(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenInclude:
+      if n, err := p.parseInclude(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenExtends:
+      if n, err := p.parseExtends(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenBlockDecl:
+      if n, err := p.parseBlockDecl(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenSuper:
+      if n, err := p.parseSuper(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
     case tokenBlock:
       if n, err := p.parseBlock(t); err != nil {
         return nil, err
@@ -188,8 +296,43 @@ func (p *parser) parseMeta(t token) (executable, error) {
         return n, nil
       }
       
+    case tokenFunc:
+      if n, err := p.parseFunc(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenCapture:
+      if n, err := p.parseCapture(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenIdentifier:
+      if p.peek(0).which == tokenLParen {
+        if n, err := p.parseCall(t); err != nil {
+          return nil, err
+        }else{
+          return n, nil
+        }
+      }
+      if n, err := p.parseStatement(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
+    case tokenBreak, tokenContinue:
+      if n, err := p.parseBranch(t); err != nil {
+        return nil, err
+      }else{
+        return n, nil
+      }
+      
     default:
-      return nil, invalidTokenError(t, tokenIf, tokenFor, tokenBlock, '(')
+      return nil, invalidTokenError(t, tokenIf, tokenFor, tokenSwitch, tokenBreak, tokenContinue, tokenFallthrough, tokenFunc, tokenCapture, tokenInclude, tokenExtends, tokenBlockDecl, tokenSuper, tokenBlock, '(', tokenIdentifier)
       
   }
 }
@@ -200,6 +343,12 @@ func (p *parser) parseMeta(t token) (executable, error) {
 func (p *parser) parseBlock(t token) (executable, error) {
   b := &containerNode{}
   
+  p.depth++
+  defer func() { p.depth-- }()
+  
+  p.pushScope()
+  defer func() { b.scoped = p.popScope() }()
+  
   outer: for {
     t := p.next()
     if DEBUG_TRACE_TOKEN {
@@ -222,6 +371,8 @@ func (p *parser) parseBlock(t token) (executable, error) {
       case tokenMeta:
         if n, err := p.parseMeta(t); err != nil {
           return nil, err
+        }else if e, ok := n.(*extendsNode); ok {
+          return nil, &parserError{"Extends may only be used at the top level of a template", e.span, nil}
         }else{
           b.add(n)
         }
@@ -273,257 +424,982 @@ func (p *parser) parseIf(t token) (executable, error) {
 }
 
 /**
- * Parse
+ * Parse a switch. The body of a switch consists only of cases, which may be
+ * separated by whitespace.
  */
-func (p *parser) parseFor(t token) (executable, error) {
+func (p *parser) parseSwitch(t token) (executable, error) {
+  var expr expression
+  var err error
+  
+  if p.peek(0).which != tokenBlock {
+    expr, err = p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
+  }
   
-  vars, err := p.parseIdentList()
+  _, err = p.nextAssert(tokenBlock)
   if err != nil {
     return nil, err
   }
   
-  lspan := []span{}
-  for _, e := range vars {
-    lspan = append(lspan, e.src())
-  }
+  var cases []*caseNode
+  var fallthru, deflt bool
   
-  if len(vars) < 1 || len(vars) > 2 {
-    return nil, &parserError{fmt.Sprintf("Incorrect variable count: %d", len(vars)), encompass(lspan...), nil}
+  outer: for {
+    c := p.next()
+    switch c.which {
+      
+      case tokenEOF:
+        return nil, fmt.Errorf("Unexpected end-of-input")
+        
+      case tokenError:
+        return nil, fmt.Errorf("Error: %v", c)
+        
+      case tokenClose:
+        if fallthru {
+          return nil, &parserError{"Cannot fallthrough the final case in a switch", cases[len(cases)-1].span, nil}
+        }
+        t.span = encompass(t.span, c.span)
+        break outer
+        
+      case tokenVerbatim:
+        if strings.TrimSpace(c.value.(string)) != "" {
+          return nil, &parserError{"Only cases may appear in a switch", c.span, nil}
+        }
+        
+      case tokenMeta:
+        n, err := p.parseCase()
+        if err != nil {
+          return nil, err
+        }
+        if n.exprs == nil {
+          if deflt {
+            return nil, &parserError{"Multiple defaults in a switch", n.span, nil}
+          }
+          deflt = true
+        }
+        fallthru = p.fallthru
+        cases = append(cases, n)
+        
+      default:
+        return nil, invalidTokenError(c, tokenVerbatim, tokenMeta)
+        
+    }
   }
   
-  lspan = append(lspan, t.span)
-  
-  t, err = p.nextAssert(tokenAssignSpecial)
-  if err != nil {
-    return nil, err
-  }
+  return &switchNode{node{t.span, &t}, expr, cases}, nil
+}
+
+/**
+ * Parse a case in a switch
+ */
+func (p *parser) parseCase() (*caseNode, error) {
+  var exprs []expression
   
-  t, err = p.nextAssert(tokenRange)
+  t, err := p.nextAssert(tokenCase, tokenDefault)
   if err != nil {
     return nil, err
   }
   
-  expr, err := p.parseExpression()
-  if err != nil {
-    return nil, err
+  if t.which == tokenCase {
+    exprs, err = p.parseExprList()
+    if err != nil {
+      return nil, err
+    }
   }
   
-  t, err = p.nextAssert(tokenBlock)
+  b, err := p.nextAssert(tokenBlock)
   if err != nil {
     return nil, err
   }
   
-  loop, err := p.parseBlock(t)
+  ncase := p.ncase
+  p.ncase, p.fallthru = p.depth + 1, false
+  p.nswitch++
+  body, err := p.parseBlock(b)
+  p.nswitch--
+  p.ncase = ncase
   if err != nil {
     return nil, err
   }
   
-  lspan = append(lspan, loop.src())
-  return &forNode{node{encompass(lspan...), &t}, vars, expr, loop}, nil
+  return &caseNode{node{encompass(t.span, body.src()), &t}, exprs, body}, nil
 }
 
 /**
- * Parse ab expression interpolation
+ * Parse a fallthrough statement, which must be the last statement in a case
  */
-func (p *parser) parseInterpolate(t token) (executable, error) {
+func (p *parser) parseFallthrough(t token) (executable, error) {
   
-  expr, err := p.parseParen()
+  if p.ncase < 1 || p.depth != p.ncase {
+    return nil, &parserError{"Fallthrough may only be used at the end of a case", t.span, nil}
+  }
+  
+  _, err := p.nextAssert(tokenSemi)
   if err != nil {
     return nil, err
   }
   
-  return &exprNode{node{expr.src(), &t}, expr}, nil
-}
-
-/**
- * Parse
- */
-func (p *parser) parseExpression() (expression, error) {
-  return p.parseLogicalNot()
+  n := p.peek(0)
+  if n.which == tokenVerbatim && strings.TrimSpace(n.value.(string)) == "" {
+    n = p.peek(1)
+  }
+  if n.which != tokenClose {
+    return nil, &parserError{"Fallthrough may only be used at the end of a case", t.span, nil}
+  }
+  
+  p.fallthru = true
+  return &fallthroughNode{node{t.span, &t}}, nil
 }
 
 /**
- * Parse a logical not
+ * Parse a for loop, which is either a range loop, a loop with a condition,
+ * or a loop with init, condition and post clauses
  */
-func (p *parser) parseLogicalNot() (expression, error) {
-  var t token
+func (p *parser) parseFor(t token) (executable, error) {
+  var init, post executable
+  var cond expression
+  var err error
   
-  op := p.peek(0)
-  switch op.which {
-    case tokenEOF:
-      return nil, fmt.Errorf("Unexpected end-of-input")
-    case tokenError:
-      return nil, fmt.Errorf("Error: %v", op)
-    case tokenBang:
-      t = p.next() // consume the '!'
-      break // valid token
-  }
+  // variables declared by the loop are scoped to it
+  p.pushScope()
+  defer p.popScope()
   
-  right, err := p.parseLogicalOr()
-  if err != nil {
-    return nil, err
+  // for { ... }
+  if p.peek(0).which == tokenBlock {
+    return p.parseForBody(t, nil, nil, nil)
   }
   
-  if t.which == tokenBang {
-    return &logicalNotNode{node{encompass(op.span, right.src()), &op}, right}, nil
-  }else{
-    return right, nil
+  if p.peek(0).which != tokenSemi {
+    left, err := p.parseExprList()
+    if err != nil {
+      return nil, err
+    }
+    if p.peek(0).which == tokenAssignSpecial && p.peek(1).which == tokenRange {
+      return p.parseForRange(t, left)
+    }
+    if p.peek(0).which == tokenBlock {
+      if len(left) != 1 {
+        return nil, &parserError{"Expected a single loop condition", left[0].src(), nil}
+      }
+      return p.parseForBody(t, nil, left[0], nil)
+    }
+    init, err = p.parseSimpleStatement(left)
+    if err != nil {
+      return nil, err
+    }
   }
-}
-
-/**
- * Parse a logical or
- */
-func (p *parser) parseLogicalOr() (expression, error) {
   
-  left, err := p.parseLogicalAnd()
+  _, err = p.nextAssert(tokenSemi)
   if err != nil {
     return nil, err
   }
   
-  op := p.peek(0)
-  switch op.which {
-    case tokenEOF:
-      return nil, fmt.Errorf("Unexpected end-of-input")
-    case tokenError:
-      return nil, fmt.Errorf("Error: %v", op)
-    case tokenLogicalOr:
-      break // valid token
-    default:
-      return left, nil
+  if p.peek(0).which != tokenSemi {
+    cond, err = p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
   }
   
-  p.next() // consume the operator
-  right, err := p.parseLogicalOr()
+  _, err = p.nextAssert(tokenSemi)
   if err != nil {
     return nil, err
   }
   
-  return &logicalOrNode{node{encompass(op.span, left.src(), right.src()), &op}, left, right}, nil
+  if p.peek(0).which != tokenBlock {
+    left, err := p.parseExprList()
+    if err != nil {
+      return nil, err
+    }
+    post, err = p.parseSimpleStatement(left)
+    if err != nil {
+      return nil, err
+    }
+  }
+  
+  return p.parseForBody(t, init, cond, post)
 }
 
 /**
- * Parse a logical and
+ * Parse the body of a for loop with clauses
  */
-func (p *parser) parseLogicalAnd() (expression, error) {
+func (p *parser) parseForBody(t token, init executable, cond expression, post executable) (executable, error) {
   
-  left, err := p.parseRelational()
+  b, err := p.nextAssert(tokenBlock)
   if err != nil {
     return nil, err
   }
   
-  op := p.peek(0)
-  switch op.which {
-    case tokenEOF:
-      return nil, fmt.Errorf("Unexpected end-of-input")
-    case tokenError:
-      return nil, fmt.Errorf("Error: %v", op)
-    case tokenLogicalAnd:
-      break // valid token
-    default:
-      return left, nil
+  p.nloop++
+  loop, err := p.parseBlock(b)
+  p.nloop--
+  if err != nil {
+    return nil, err
   }
   
-  p.next() // consume the operator
-  right, err := p.parseLogicalAnd()
+  otherwise, err := p.parseForElse()
   if err != nil {
     return nil, err
   }
   
-  return &logicalAndNode{node{encompass(op.span, left.src(), right.src()), &op}, left, right}, nil
+  if otherwise != nil {
+    return &forClauseNode{node{encompass(t.span, loop.src(), otherwise.src()), &t}, init, cond, post, loop, otherwise}, nil
+  }else{
+    return &forClauseNode{node{encompass(t.span, loop.src()), &t}, init, cond, post, loop, nil}, nil
+  }
 }
 
 /**
- * Parse a relational expression
+ * Parse the optional else clause following a loop, which is executed when
+ * the loop performs no iterations
  */
-func (p *parser) parseRelational() (expression, error) {
-  
-  left, err := p.parseArithmeticL1()
-  if err != nil {
-    return nil, err
-  }
-  
-  op := p.peek(0)
-  switch op.which {
-    case tokenEOF:
-      return nil, fmt.Errorf("Unexpected end-of-input")
-    case tokenError:
-      return nil, fmt.Errorf("Error: %v", op)
-    case tokenLess, tokenGreater, tokenEqual, tokenLessEqual, tokenGreaterEqual, tokenNotEqual:
-      break // valid tokens
-    default:
-      return left, nil
+func (p *parser) parseForElse() (executable, error) {
+  t := p.peek(0)
+  if t.which != tokenElse {
+    return nil, nil
   }
+  p.next() // consume 'else'
   
-  p.next() // consume the operator
-  right, err := p.parseRelational()
+  // unlike if, the else clause of a loop must be a block
+  b, err := p.nextAssert(tokenBlock)
   if err != nil {
     return nil, err
   }
   
-  return &relationalNode{node{encompass(op.span, left.src(), right.src()), &op}, op, left, right}, nil
+  return p.parseBlock(b)
 }
 
 /**
- * Parse an arithmetic expression
+ * Parse a range loop given its variables
  */
-func (p *parser) parseArithmeticL1() (expression, error) {
+func (p *parser) parseForRange(t token, vars []expression) (executable, error) {
   
-  left, err := p.parseArithmeticL2()
-  if err != nil {
-    return nil, err
+  lspan := []span{}
+  for _, e := range vars {
+    v, ok := e.(*identNode)
+    if !ok {
+      return nil, &parserError{"Expected identifier for range variable", e.src(), nil}
+    }
+    lspan = append(lspan, e.src())
+    p.declare(v.ident)
   }
   
-  op := p.peek(0)
-  switch op.which {
-    case tokenEOF:
-      return nil, fmt.Errorf("Unexpected end-of-input")
-    case tokenError:
-      return nil, fmt.Errorf("Error: %v", op)
-    case tokenAdd, tokenSub:
-      break // valid tokens
-    default:
-      return left, nil
+  if len(vars) < 1 || len(vars) > 3 {
+    return nil, &parserError{fmt.Sprintf("Incorrect variable count: %d", len(vars)), encompass(lspan...), nil}
   }
   
-  p.next() // consume the operator
-  right, err := p.parseArithmeticL1()
+  // a third variable is bound to the loop metadata
+  scope := &rangeScope{}
+  if len(vars) > 2 {
+    scope.ident = vars[2].(*identNode).ident
+  }
+  
+  lspan = append(lspan, t.span)
+  
+  t, err := p.nextAssert(tokenAssignSpecial)
   if err != nil {
     return nil, err
   }
   
-  return &arithmeticNode{node{encompass(op.span, left.src(), right.src()), &op}, op, left, right}, nil
-}
-
-/**
- * Parse an arithmetic expression
- */
-func (p *parser) parseArithmeticL2() (expression, error) {
+  t, err = p.nextAssert(tokenRange)
+  if err != nil {
+    return nil, err
+  }
   
-  left, err := p.parseDeref(nil)
+  expr, err := p.parseExpression()
   if err != nil {
     return nil, err
   }
   
-  op := p.peek(0)
+  t, err = p.nextAssert(tokenBlock)
+  if err != nil {
+    return nil, err
+  }
+  
+  p.nloop++
+  p.ranges = append(p.ranges, scope)
+  loop, err := p.parseBlock(t)
+  p.ranges = p.ranges[:len(p.ranges)-1]
+  p.nloop--
+  if err != nil {
+    return nil, err
+  }
+  
+  lspan = append(lspan, loop.src())
+  
+  otherwise, err := p.parseForElse()
+  if err != nil {
+    return nil, err
+  }
+  if otherwise != nil {
+    lspan = append(lspan, otherwise.src())
+  }
+  
+  return &forNode{node{encompass(lspan...), &t}, vars, expr, loop, otherwise, scope.last}, nil
+}
+
+/**
+ * Parse a break or continue statement
+ */
+func (p *parser) parseBranch(t token) (executable, error) {
+  
+  e, err := p.parsePrimaryToken(t)
+  if err != nil {
+    return nil, err
+  }
+  
+  _, err = p.nextAssert(tokenSemi)
+  if err != nil {
+    return nil, err
+  }
+  
+  return &exprNode{node{t.span, &t}, e}, nil
+}
+
+/**
+ * Parse a function definition
+ */
+func (p *parser) parseFunc(t token) (executable, error) {
+  var params []string
+  
+  n, err := p.nextAssert(tokenIdentifier)
+  if err != nil {
+    return nil, err
+  }
+  
+  _, err = p.nextAssert(tokenLParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  if p.peek(0).which != tokenRParen {
+    list, err := p.parseIdentList()
+    if err != nil {
+      return nil, err
+    }
+    for _, e := range list {
+      params = append(params, e.(*identNode).ident)
+    }
+  }
+  
+  _, err = p.nextAssert(tokenRParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  b, err := p.nextAssert(tokenBlock)
+  if err != nil {
+    return nil, err
+  }
+  
+  // the function is declared before its body so that it may call itself
+  name := n.value.(string)
+  p.declare(name)
+  
+  p.pushScope()
+  for _, e := range params {
+    p.declare(e)
+  }
+  
+  // loops and switches do not extend into the body of a function
+  nloop, nswitch, ncase := p.nloop, p.nswitch, p.ncase
+  p.nloop, p.nswitch, p.ncase = 0, 0, 0
+  body, err := p.parseBlock(b)
+  p.nloop, p.nswitch, p.ncase = nloop, nswitch, ncase
+  p.popScope()
+  if err != nil {
+    return nil, err
+  }
+  
+  return &funcNode{node{encompass(t.span, body.src()), &t}, name, params, body}, nil
+}
+
+/**
+ * Parse a capture, which assigns the output of a block to a variable
+ */
+func (p *parser) parseCapture(t token) (executable, error) {
+  
+  n, err := p.nextAssert(tokenIdentifier)
+  if err != nil {
+    return nil, err
+  }
+  
+  b, err := p.nextAssert(tokenBlock)
+  if err != nil {
+    return nil, err
+  }
+  
+  body, err := p.parseBlock(b)
+  if err != nil {
+    return nil, err
+  }
+  
+  // the variable is declared after the block, which cannot refer to it
+  name := n.value.(string)
+  p.declare(name)
+  
+  return &captureNode{node{encompass(t.span, body.src()), &t}, name, body}, nil
+}
+
+/**
+ * Parse a function call statement, the output of which is interpolated
+ */
+func (p *parser) parseCall(t token) (executable, error) {
+  
+  op, err := p.nextAssert(tokenLParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  params, err := p.parseExprList()
+  if err != nil {
+    return nil, err
+  }
+  
+  e, err := p.nextAssert(tokenRParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  right := &identNode{node{t.span, &t}, t.value.(string)}
+  return &exprNode{node{encompass(t.span, e.span), &t}, &invokeNode{node{encompass(op.span, right.src(), e.span), &op}, nil, right, params}}, nil
+}
+
+/**
+ * Parse a simple statement that begins with the provided identifier and is
+ * terminated by a semicolon
+ */
+func (p *parser) parseStatement(t token) (executable, error) {
+  
+  left := []expression{&identNode{node{t.span, &t}, t.value.(string)}}
+  if p.peek(0).which == tokenComma {
+    p.next() // consume the comma
+    more, err := p.parseIdentList()
+    if err != nil {
+      return nil, err
+    }
+    left = append(left, more...)
+  }
+  
+  n, err := p.parseSimpleStatement(left)
+  if err != nil {
+    return nil, err
+  }
+  
+  _, err = p.nextAssert(tokenSemi)
+  if err != nil {
+    return nil, err
+  }
+  
+  return n, nil
+}
+
+/**
+ * Parse the remainder of a simple statement (declaration, assignment,
+ * increment or decrement) given its left-hand side
+ */
+func (p *parser) parseSimpleStatement(left []expression) (executable, error) {
+  
+  lspan := make([]span, len(left))
+  names := make([]string, len(left))
+  for i, e := range left {
+    v, ok := e.(*identNode)
+    if !ok {
+      return nil, &parserError{"Expected identifier on left side of statement", e.src(), nil}
+    }
+    lspan[i], names[i] = v.src(), v.ident
+  }
+  
+  op := p.next()
   switch op.which {
     case tokenEOF:
       return nil, fmt.Errorf("Unexpected end-of-input")
     case tokenError:
       return nil, fmt.Errorf("Error: %v", op)
-    case tokenMul, tokenDiv, tokenMod:
-      break // valid tokens
+      
+    case tokenAssignSpecial, tokenAssign:
+      right, err := p.parseExprList()
+      if err != nil {
+        return nil, err
+      }
+      for _, e := range right {
+        lspan = append(lspan, e.src())
+      }
+      s := encompass(append(lspan, op.span)...)
+      if len(left) != len(right) {
+        return nil, &parserError{fmt.Sprintf("Assignment mismatch: %d variables but %d values", len(left), len(right)), s, nil}
+      }
+      if op.which == tokenAssign {
+        for i, e := range names {
+          if !p.declared(e, false) {
+            return nil, &parserError{fmt.Sprintf("Cannot assign to undeclared variable '%v'", e), lspan[i], nil}
+          }
+        }
+        return &assignNode{node{s, &op}, false, names, right}, nil
+      }
+      var fresh bool
+      for _, e := range names {
+        if !p.declared(e, true) {
+          p.declare(e)
+          fresh = true
+        }
+      }
+      if !fresh {
+        return nil, &parserError{"No new variables on left side of :=", s, nil}
+      }
+      return &assignNode{node{s, &op}, true, names, right}, nil
+      
+    case tokenAddEqual, tokenSubEqual, tokenMulEqual, tokenDivEqual, tokenInc, tokenDec:
+      if len(left) != 1 {
+        return nil, &parserError{fmt.Sprintf("Operator %v takes a single variable", op.which), encompass(append(lspan, op.span)...), nil}
+      }
+      if !p.declared(names[0], false) {
+        return nil, &parserError{fmt.Sprintf("Cannot assign to undeclared variable '%v'", names[0]), lspan[0], nil}
+      }
+      var right expression
+      if op.which == tokenInc || op.which == tokenDec {
+        right = &literalNode{node{op.span, &op}, int64(1)}
+      }else{
+        var err error
+        right, err = p.parseExpression()
+        if err != nil {
+          return nil, err
+        }
+      }
+      s := encompass(lspan[0], op.span, right.src())
+      a := token{op.span, op.which & 0xff, string(rune(op.which & 0xff))} // the arithmetic operator: '+', '-', '*' or '/'
+      return &assignNode{node{s, &op}, false, names, []expression{&arithmeticNode{node{s, &a}, a, left[0], right}}}, nil
+      
     default:
+      return nil, invalidTokenError(op, tokenAssignSpecial, tokenAssign, tokenAddEqual, tokenSubEqual, tokenMulEqual, tokenDivEqual, tokenInc, tokenDec)
+  }
+}
+
+/**
+ * Parse an include
+ */
+func (p *parser) parseInclude(t token) (executable, error) {
+  
+  _, err := p.nextAssert(tokenLParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  params, err := p.parseExprList()
+  if err != nil {
+    return nil, err
+  }
+  
+  e, err := p.nextAssert(tokenRParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  s := encompass(t.span, e.span)
+  switch len(params) {
+    case 1:
+      return &includeNode{node{s, &t}, params[0], nil}, nil
+    case 2:
+      return &includeNode{node{s, &t}, params[0], params[1]}, nil
+    default:
+      return nil, &parserError{fmt.Sprintf("Include takes 1 or 2 arguments but is given %d", len(params)), s, nil}
+  }
+}
+
+/**
+ * Parse an extends
+ */
+func (p *parser) parseExtends(t token) (executable, error) {
+  
+  _, err := p.nextAssert(tokenLParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  name, err := p.parseExpression()
+  if err != nil {
+    return nil, err
+  }
+  
+  e, err := p.nextAssert(tokenRParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  return &extendsNode{node{encompass(t.span, e.span), &t}, name}, nil
+}
+
+/**
+ * Parse a named block declaration
+ */
+func (p *parser) parseBlockDecl(t token) (executable, error) {
+  
+  n, err := p.nextAssert(tokenIdentifier)
+  if err != nil {
+    return nil, err
+  }
+  
+  name := n.value.(string)
+  if _, ok := p.blocks[name]; ok {
+    return nil, &parserError{fmt.Sprintf("Block '%v' is already declared", name), encompass(t.span, n.span), nil}
+  }
+  
+  b, err := p.nextAssert(tokenBlock)
+  if err != nil {
+    return nil, err
+  }
+  
+  p.nblock++
+  body, err := p.parseBlock(b)
+  p.nblock--
+  if err != nil {
+    return nil, err
+  }
+  
+  decl := &blockNode{node{encompass(t.span, n.span, body.src()), &t}, name, body}
+  p.blocks[name] = decl
+  return decl, nil
+}
+
+/**
+ * Parse a super
+ */
+func (p *parser) parseSuper(t token) (executable, error) {
+  
+  _, err := p.nextAssert(tokenLParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  e, err := p.nextAssert(tokenRParen)
+  if err != nil {
+    return nil, err
+  }
+  
+  s := encompass(t.span, e.span)
+  if p.nblock < 1 {
+    return nil, &parserError{"Super may only be used within a block", s, nil}
+  }
+  
+  return &superNode{node{s, &t}}, nil
+}
+
+/**
+ * Parse ab expression interpolation
+ */
+func (p *parser) parseInterpolate(t token) (executable, error) {
+  
+  expr, err := p.parseParen()
+  if err != nil {
+    return nil, err
+  }
+  
+  return &exprNode{node{expr.src(), &t}, expr}, nil
+}
+
+/**
+ * Parse
+ */
+func (p *parser) parseExpression() (expression, error) {
+  return p.parsePipe()
+}
+
+/**
+ * Parse a pipeline, in which the result of each stage is provided as the
+ * first argument to the function that follows it: a | f | g(b)
+ */
+func (p *parser) parsePipe() (expression, error) {
+  
+  left, err := p.parseConditional()
+  if err != nil {
+    return nil, err
+  }
+  
+  for {
+    
+    op := p.peek(0)
+    switch op.which {
+      case tokenEOF:
+        return nil, fmt.Errorf("Unexpected end-of-input")
+      case tokenError:
+        return nil, fmt.Errorf("Error: %v", op)
+      case tokenPipe:
+        break // valid token
+      default:
+        return left, nil
+    }
+    
+    p.next() // consume the operator
+    t, err := p.nextAssert(tokenIdentifier)
+    if err != nil {
+      return nil, err
+    }
+    
+    right := &identNode{node{t.span, &t}, t.value.(string)}
+    var params []expression
+    end := t.span
+    
+    if p.peek(0).which == tokenLParen {
+      p.next() // consume the '('
+      params, err = p.parseExprList()
+      if err != nil {
+        return nil, err
+      }
+      e, err := p.nextAssert(tokenRParen)
+      if err != nil {
+        return nil, err
+      }
+      end = e.span
+    }
+    
+    left = &pipeNode{node{encompass(op.span, left.src(), end), &op}, op, left, right, params}
+  }
+  
+}
+
+/**
+ * Parse a conditional expression: cond ? a : b
+ */
+func (p *parser) parseConditional() (expression, error) {
+  
+  cond, err := p.parseBinary(precCoalesce)
+  if err != nil {
+    return nil, err
+  }
+  
+  op := p.peek(0)
+  switch op.which {
+    case tokenEOF:
+      return nil, fmt.Errorf("Unexpected end-of-input")
+    case tokenError:
+      return nil, fmt.Errorf("Error: %v", op)
+    case tokenQuestion:
+      break // valid token
+    default:
+      return cond, nil
+  }
+  
+  p.next() // consume the operator
+  iftrue, err := p.parseExpression()
+  if err != nil {
+    return nil, err
+  }
+  
+  _, err = p.nextAssert(tokenColon)
+  if err != nil {
+    return nil, err
+  }
+  
+  iffalse, err := p.parseConditional()
+  if err != nil {
+    return nil, err
+  }
+  
+  return &conditionalNode{node{encompass(op.span, cond.src(), iftrue.src(), iffalse.src()), &op}, cond, iftrue, iffalse}, nil
+}
+
+/**
+ * Binary operator precedence levels, from lowest to highest
+ */
+const (
+  precNone          = iota
+  precCoalesce      = iota
+  precLogicalOr     = iota
+  precLogicalAnd    = iota
+  precRelational    = iota
+  precAdditive      = iota
+  precMultiplicative = iota
+)
+
+/**
+ * A binary operator
+ */
+type binaryOperator struct {
+  prec    int
+  chains  bool // whether the operator may be chained with others of its precedence
+  build   func(n node, op token, left, right expression) expression
+}
+
+/**
+ * Binary operators. Operators of the same precedence are left-associative.
+ */
+var binaryOperators map[tokenType]binaryOperator
+
+func init() {
+  
+  coalesce := func(n node, op token, left, right expression) expression {
+    return &coalesceNode{n, left, right}
+  }
+  logicalOr := func(n node, op token, left, right expression) expression {
+    return &logicalOrNode{n, left, right}
+  }
+  logicalAnd := func(n node, op token, left, right expression) expression {
+    return &logicalAndNode{n, left, right}
+  }
+  relational := func(n node, op token, left, right expression) expression {
+    return &relationalNode{n, op, left, right}
+  }
+  arithmetic := func(n node, op token, left, right expression) expression {
+    return &arithmeticNode{n, op, left, right}
+  }
+  
+  binaryOperators = map[tokenType]binaryOperator{
+    tokenCoalesce:      {precCoalesce, true, coalesce},
+    tokenLogicalOr:     {precLogicalOr, true, logicalOr},
+    tokenLogicalAnd:    {precLogicalAnd, true, logicalAnd},
+    tokenEqual:         {precRelational, false, relational},
+    tokenNotEqual:      {precRelational, false, relational},
+    tokenLess:          {precRelational, false, relational},
+    tokenLessEqual:     {precRelational, false, relational},
+    tokenGreater:       {precRelational, false, relational},
+    tokenGreaterEqual:  {precRelational, false, relational},
+    tokenAdd:           {precAdditive, true, arithmetic},
+    tokenSub:           {precAdditive, true, arithmetic},
+    tokenCaret:         {precAdditive, true, arithmetic},
+    tokenMul:           {precMultiplicative, true, arithmetic},
+    tokenDiv:           {precMultiplicative, true, arithmetic},
+    tokenMod:           {precMultiplicative, true, arithmetic},
+    tokenAmp:           {precMultiplicative, true, arithmetic},
+    tokenAndNot:        {precMultiplicative, true, arithmetic},
+    tokenShiftLeft:     {precMultiplicative, true, arithmetic},
+    tokenShiftRight:    {precMultiplicative, true, arithmetic},
+  }
+  
+}
+
+/**
+ * Parse a binary expression by precedence climbing. Only operators with a
+ * precedence of at least the provided minimum are consumed.
+ */
+func (p *parser) parseBinary(min int) (expression, error) {
+  
+  left, err := p.parseUnary()
+  if err != nil {
+    return nil, err
+  }
+  
+  var last token
+  prec := precNone
+  for {
+    
+    op := p.peek(0)
+    switch op.which {
+      case tokenEOF:
+        return nil, fmt.Errorf("Unexpected end-of-input")
+      case tokenError:
+        return nil, fmt.Errorf("Error: %v", op)
+    }
+    
+    b, ok := binaryOperators[op.which]
+    if !ok || b.prec < min {
       return left, nil
+    }
+    if !b.chains && prec == b.prec {
+      return nil, &parserError{fmt.Sprintf("Operators %v and %v cannot be chained; use parentheses", last.which, op.which), op.span, nil}
+    }
+    
+    p.next() // consume the operator
+    right, err := p.parseBinary(b.prec + 1)
+    if err != nil {
+      return nil, err
+    }
+    
+    left = foldDecimal(b.build(node{encompass(op.span, left.src(), right.src()), &op}, op, left, right))
+    last, prec = op, b.prec
+  }
+  
+}
+
+/**
+ * Fold an arithmetic expression on numeric literals, at least one of which is
+ * a decimal, into a single decimal literal. As with untyped constants in Go,
+ * the value is computed exactly, so that it remains exact when it is used with
+ * an arbitrary-precision number. Any other expression is returned as it is.
+ */
+func foldDecimal(e expression) expression {
+  var n node
+  var op tokenType
+  var operands []expression
+  switch v := e.(type) {
+    case *unaryNode:
+      n, op, operands = v.node, v.op.which, []expression{v.right}
+    case *arithmeticNode:
+      n, op, operands = v.node, v.op.which, []expression{v.left, v.right}
+    default:
+      return e
+  }
+  
+  var decimal bool
+  x := make([]*big.Rat, len(operands))
+  for i, o := range operands {
+    l, ok := o.(*numberNode)
+    if !ok {
+      return e
+    }
+    if l.exact != nil {
+      x[i], decimal = l.exact, true
+    }else{
+      x[i] = toBigRat(l.value)
+    }
+  }
+  if !decimal {
+    return e // integer arithmetic is performed as usual
+  }
+  
+  r := new(big.Rat)
+  switch {
+    case len(x) == 1 && op == tokenAdd:
+      r.Set(x[0])
+    case len(x) == 1 && op == tokenSub:
+      r.Neg(x[0])
+    case len(x) == 1:
+      return e
+    case op == tokenAdd:
+      r.Add(x[0], x[1])
+    case op == tokenSub:
+      r.Sub(x[0], x[1])
+    case op == tokenMul:
+      r.Mul(x[0], x[1])
+    case op == tokenDiv && x[1].Sign() != 0:
+      r.Quo(x[0], x[1])
+    default:
+      return e
+  }
+  
+  f, _ := r.Float64()
+  return &numberNode{n, f, numericFloat, r}
+}
+
+/**
+ * Parse a unary expression: -a, +a, !a
+ */
+func (p *parser) parseUnary() (expression, error) {
+  
+  op := p.peek(0)
+  switch op.which {
+    case tokenEOF:
+      return nil, fmt.Errorf("Unexpected end-of-input")
+    case tokenError:
+      return nil, fmt.Errorf("Error: %v", op)
+    case tokenAdd, tokenSub, tokenBang:
+      break // valid tokens
+    default:
+      return p.parseDeref(nil)
   }
   
   p.next() // consume the operator
-  right, err := p.parseArithmeticL2()
+  right, err := p.parseUnary()
   if err != nil {
     return nil, err
   }
   
-  return &arithmeticNode{node{encompass(op.span, left.src(), right.src()), &op}, op, left, right}, nil
+  if op.which == tokenBang {
+    return &logicalNotNode{node{encompass(op.span, right.src()), &op}, right}, nil
+  }else{
+    return foldDecimal(&unaryNode{node{encompass(op.span, right.src()), &op}, op, right}), nil
+  }
 }
 
 /**
@@ -542,7 +1418,7 @@ func (p *parser) parseDeref(prev expression) (expression, error) {
       return nil, fmt.Errorf("Unexpected end-of-input")
     case tokenError:
       return nil, fmt.Errorf("Error: %v", op)
-    case tokenDot:
+    case tokenDot, tokenSafeDot:
       break // valid token
     default:
       return left, nil
@@ -556,13 +1432,53 @@ func (p *parser) parseDeref(prev expression) (expression, error) {
   
   switch v := right.(type) {
     case *identNode, *derefNode, *indexNode, *invokeNode:
-      return &derefNode{node{encompass(op.span, left.src()), &op}, left, v}, nil
+      p.referLast(left, v)
+      return &derefNode{node{encompass(op.span, left.src()), &op}, left, v, op.which == tokenSafeDot}, nil
     default:
       return nil, fmt.Errorf("Expected ident, deref, subscript or method call: %T", right)
   }
   
 }
 
+/**
+ * Note a reference to the Last field of loop metadata, like 'l.Last' or
+ * 'l.Parent.Last', so that the range loop it describes determines which of
+ * its iterations is the last
+ */
+func (p *parser) referLast(left, right expression) {
+  l, ok := left.(*identNode)
+  if !ok {
+    return
+  }
+  
+  var up int
+  for {
+    switch v := right.(type) {
+      case *identNode:
+        if v.ident != "Last" {
+          return
+        }
+        for i := len(p.ranges) - 1; i >= 0; i-- {
+          if p.ranges[i].ident == l.ident {
+            if i >= up {
+              p.ranges[i - up].last = true
+            }
+            return
+          }
+        }
+        return
+      case *derefNode:
+        if f, ok := v.left.(*identNode); !ok || f.ident != "Parent" {
+          return
+        }
+        right = v.right
+        up++
+      default:
+        return
+    }
+  }
+}
+
 /**
  * Parse a function invocation expression
  */
@@ -627,16 +1543,42 @@ func (p *parser) parseSubscript(left expression) (expression, error) {
       return nil, fmt.Errorf("Unexpected end-of-input")
     case tokenError:
       return nil, fmt.Errorf("Error: %v", op)
-    case tokenLBracket:
+    case tokenLBracket, tokenSafeBracket:
       break // valid token
     default:
       return left, nil
   }
   
   p.next() // consume the '['
-  right, err := p.parseExpression()
-  if err != nil {
-    return nil, err
+  
+  var lo, hi expression
+  var err error
+  if p.peek(0).which != tokenColon {
+    lo, err = p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
+  }
+  
+  // a slice expression: a[lo:hi], where either bound may be omitted
+  if p.peek(0).which == tokenColon {
+    p.next() // consume the ':'
+    if p.peek(0).which != tokenRBracket {
+      hi, err = p.parseExpression()
+      if err != nil {
+        return nil, err
+      }
+    }
+    t, err := p.nextAssert(tokenRBracket)
+    if err != nil {
+      return nil, err
+    }
+    sub := encompass(op.span, t.span)
+    return p.parseSubscript(&sliceNode{node{encompass(left.src(), sub), &op}, left, lo, hi, sub, op.which == tokenSafeBracket})
+  }
+  
+  if lo == nil {
+    return nil, invalidTokenError(p.peek(0), tokenColon)
   }
   
   t, err := p.nextAssert(tokenRBracket)
@@ -644,14 +1586,20 @@ func (p *parser) parseSubscript(left expression) (expression, error) {
     return nil, err
   }
   
-  return p.parseSubscript(&indexNode{node{encompass(op.span, left.src(), right.src(), t.span), &op}, left, right})
+  return p.parseSubscript(&indexNode{node{encompass(op.span, left.src(), lo.src(), t.span), &op}, left, lo, op.which == tokenSafeBracket})
 }
 
 /**
  * Parse a primary expression
  */
 func (p *parser) parsePrimary() (expression, error) {
-  t := p.next()
+  return p.parsePrimaryToken(p.next())
+}
+
+/**
+ * Parse a primary expression beginning with the provided token
+ */
+func (p *parser) parsePrimaryToken(t token) (expression, error) {
   switch t.which {
     case tokenEOF:
       return nil, fmt.Errorf("Unexpected end-of-input")
@@ -660,12 +1608,25 @@ func (p *parser) parsePrimary() (expression, error) {
     case tokenLParen:
       return p.parseParen()
     case tokenBreak:
+      if p.nloop < 1 && p.nswitch < 1 {
+        return nil, &parserError{"Break outside of a loop or switch", t.span, nil}
+      }
       return &breakNode{node{t.span, &t}}, nil
     case tokenContinue:
+      if p.nloop < 1 {
+        return nil, &parserError{"Continue outside of a loop", t.span, nil}
+      }
       return &continueNode{node{t.span, &t}}, nil
     case tokenIdentifier:
       return &identNode{node{t.span, &t}, t.value.(string)}, nil
-    case tokenNumber, tokenString:
+    case tokenNumber:
+      n := t.value.(numberLiteral)
+      var exact *big.Rat
+      if n.kind == numericFloat {
+        exact, _ = new(big.Rat).SetString(n.text)
+      }
+      return &numberNode{node{t.span, &t}, n.value, n.kind, exact}, nil
+    case tokenString:
       return &literalNode{node{t.span, &t}, t.value}, nil
     case tokenTrue:
       return &literalNode{node{t.span, &t}, true}, nil
@@ -673,9 +1634,95 @@ func (p *parser) parsePrimary() (expression, error) {
       return &literalNode{node{t.span, &t}, false}, nil
     case tokenNil:
       return &literalNode{node{t.span, &t}, nil}, nil
+    case tokenLBracket:
+      return p.parseList(t)
+    case tokenLBrace:
+      return p.parseMap(t)
+    case tokenMap:
+      b, err := p.nextAssert(tokenLBrace)
+      if err != nil {
+        return nil, err
+      }
+      return p.parseMap(b)
     default:
-      return nil, invalidTokenError(t, tokenLParen, tokenBreak, tokenContinue, tokenIdentifier, tokenNumber, tokenString, tokenTrue, tokenFalse, tokenNil)
+      return nil, invalidTokenError(t, tokenLParen, tokenBreak, tokenContinue, tokenIdentifier, tokenNumber, tokenString, tokenTrue, tokenFalse, tokenNil, tokenLBracket, tokenLBrace, tokenMap)
+  }
+}
+
+/**
+ * Parse a list literal. The opening '[' has already been consumed.
+ */
+func (p *parser) parseList(t token) (expression, error) {
+  items := make([]expression, 0)
+  
+  for p.peek(0).which != tokenRBracket {
+    
+    e, err := p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
+    
+    items = append(items, e)
+    
+    // a trailing comma is permitted
+    if p.peek(0).which == tokenComma {
+      p.next() // consume the comma
+    }else{
+      break
+    }
+    
+  }
+  
+  e, err := p.nextAssert(tokenRBracket)
+  if err != nil {
+    return nil, err
+  }
+  
+  return &listNode{node{encompass(t.span, e.span), &t}, items}, nil
+}
+
+/**
+ * Parse a map literal. The opening '{' has already been consumed.
+ */
+func (p *parser) parseMap(t token) (expression, error) {
+  keys := make([]expression, 0)
+  vals := make([]expression, 0)
+  
+  for p.peek(0).which != tokenRBrace {
+    
+    k, err := p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
+    
+    _, err = p.nextAssert(tokenColon)
+    if err != nil {
+      return nil, err
+    }
+    
+    v, err := p.parseExpression()
+    if err != nil {
+      return nil, err
+    }
+    
+    keys = append(keys, k)
+    vals = append(vals, v)
+    
+    // a trailing comma is permitted
+    if p.peek(0).which == tokenComma {
+      p.next() // consume the comma
+    }else{
+      break
+    }
+    
   }
+  
+  e, err := p.nextAssert(tokenRBrace)
+  if err != nil {
+    return nil, err
+  }
+  
+  return &mapNode{node{encompass(t.span, e.span), &t}, keys, vals}, nil
 }
 
 /**
@@ -33,13 +33,19 @@ package ego
 import (
   "io"
   "os"
+  "bytes"
   "fmt"
+  "math"
+  "math/big"
+  "strings"
   "reflect"
+  "unicode/utf8"
 )
 
 var (
   errBreak    = fmt.Errorf("break")
   errContinue = fmt.Errorf("continue")
+  errFallthrough = fmt.Errorf("fallthrough")
 )
 
 /**
@@ -54,18 +60,24 @@ type Context interface {
  */
 type VariableProvider func(name string)(interface{}, error)
 
+/**
+ * A frame of variables declared in a scope
+ */
+type frame map[string]interface{}
+
 /**
  * Executable context
  */
 type context struct {
   stack   []interface{}
+  loop    *Loop // the metadata of the innermost range loop being executed, if any
 }
 
 /**
  * Create a new context
  */
 func newContext(f interface{}) *context {
-  return &context{[]interface{}{stdlib, f}}
+  return &context{[]interface{}{stdlib, f}, nil}
 }
 
 /**
@@ -91,6 +103,34 @@ func (c *context) pop() *context {
   return c
 }
 
+/**
+ * Declare a variable in the current frame
+ */
+func (c *context) declare(s span, n string, v interface{}) error {
+  if l := len(c.stack); l > 0 {
+    if f, ok := c.stack[l-1].(frame); ok {
+      f[n] = v
+      return nil
+    }
+  }
+  return runtimeErrorf(s, "Cannot declare variable '%v' outside of a scope", n)
+}
+
+/**
+ * Assign a variable in the nearest frame which declares it
+ */
+func (c *context) assign(s span, n string, v interface{}) error {
+  for i := len(c.stack) - 1; i >= 0; i-- {
+    if f, ok := c.stack[i].(frame); ok {
+      if _, ok := f[n]; ok {
+        f[n] = v
+        return nil
+      }
+    }
+  }
+  return runtimeErrorf(s, "Cannot assign to undeclared variable '%v'", n)
+}
+
 /**
  * Obtain a value
  */
@@ -107,6 +147,15 @@ func (c *context) sget(s span, n string, k []interface{}) (interface{}, error) {
     return nil, nil
   }
   
+  // a declared variable shadows outer frames even if its value is nil
+  if f, ok := k[l-1].(frame); ok {
+    if v, ok := f[n]; ok {
+      return v, nil
+    }else{
+      return c.sget(s, n, k[:l-1])
+    }
+  }
+  
   v, err := derefProp(s, k[l-1], n)
   if err != nil {
     return nil, err
@@ -124,7 +173,34 @@ func (c *context) sget(s span, n string, k []interface{}) (interface{}, error) {
  */
 type Runtime struct {
   Stdout    io.Writer
+  Escape    EscapeMode
+  Loader    Loader
+  MaxIterations int // the maximum number of iterations of any one loop, or zero for no limit
+  UnsortedMaps  bool // iterate over maps in Go's unspecified order instead of sorting their keys
+  NilDeref      bool // dereferencing or indexing nil with '.' or '[]' produces nil instead of an error
+  RuneStrings   bool // string indexes and slice bounds count characters instead of bytes
   attrs     map[string]interface{}
+  html      *htmlContext
+  includes  []string
+  overrides []map[string]*blockNode // blocks declared by extending templates, most derived first
+  supers    [][]*blockNode          // the chains of blocks being executed
+  calls     int                     // the depth of template function calls
+}
+
+/**
+ * Obtain a new runtime with the same settings as this one. Attributes and
+ * execution state are not copied.
+ */
+func (r *Runtime) settings() *Runtime {
+  return &Runtime{
+    Stdout:         r.Stdout,
+    Escape:         r.Escape,
+    Loader:         r.Loader,
+    MaxIterations:  r.MaxIterations,
+    UnsortedMaps:   r.UnsortedMaps,
+    NilDeref:       r.NilDeref,
+    RuneStrings:    r.RuneStrings,
+  }
 }
 
 /**
@@ -148,6 +224,68 @@ func (r *Runtime) SetAttr(k string, v interface{}) {
   r.attrs[k] = v
 }
 
+/**
+ * Write verbatim output. When escaping is enabled the escaping context is
+ * advanced over the output.
+ */
+func (r *Runtime) writeVerbatim(s string) error {
+  if r.Escape == EscapeHTML {
+    r.htmlContext().advance(s)
+  }
+  _, err := io.WriteString(r.Stdout, s)
+  return err
+}
+
+/**
+ * Load a template by name. The span is that of the statement which refers
+ * to the template and is used to report errors, including cycles.
+ */
+func (r *Runtime) load(s span, name string) (*Program, error) {
+  if r.Loader == nil {
+    return nil, runtimeErrorf(s, "Cannot load %q: no loader is configured", name)
+  }
+  for _, e := range r.includes {
+    if e == name {
+      return nil, runtimeErrorf(s, "Include cycle: %v", strings.Join(append(r.includes, name), " -> "))
+    }
+  }
+  prog, err := r.Loader.Load(name)
+  if err != nil {
+    return nil, &runtimeError{fmt.Sprintf("Cannot load %q", name), s, err}
+  }
+  return prog, nil
+}
+
+/**
+ * Check that a loop may perform another iteration, given the number it has
+ * already performed
+ */
+func (r *Runtime) checkIterations(s span, n int) error {
+  if r.MaxIterations > 0 && n >= r.MaxIterations {
+    return runtimeErrorf(s, "Loop exceeded the maximum of %d iterations", r.MaxIterations)
+  }
+  return nil
+}
+
+/**
+ * Execute the first block in a chain of overrides
+ */
+func (r *Runtime) execBlocks(chain []*blockNode, context *context) error {
+  r.supers = append(r.supers, chain)
+  defer func() { r.supers = r.supers[:len(r.supers)-1] }()
+  return chain[0].body.exec(r, context)
+}
+
+/**
+ * Obtain the HTML escaping context
+ */
+func (r *Runtime) htmlContext() *htmlContext {
+  if r.html == nil {
+    r.html = &htmlContext{}
+  }
+  return r.html
+}
+
 /**
  * Execution state
  */
@@ -196,6 +334,8 @@ func (n node) src() span {
  */
 type Program struct {
   containerNode
+  extends   *extendsNode
+  blocks    map[string]*blockNode
 }
 
 /**
@@ -205,6 +345,7 @@ func (n *Program) Exec(rt *Runtime, cxt interface{}) error {
   if rt.Stdout == nil {
     rt.Stdout = os.Stdout
   }
+  rt.html = nil // reset the escaping context
   switch v := cxt.(type) {
     case *context:
       return n.exec(rt, v)
@@ -213,12 +354,62 @@ func (n *Program) Exec(rt *Runtime, cxt interface{}) error {
   }
 }
 
+/**
+ * Execute a program. If the program extends a parent, the parent is executed
+ * in its place with this program's blocks overriding those of the parent.
+ * The declarations outside of this program's blocks are executed first, so
+ * that its blocks may refer to them, but nothing else outside of its blocks
+ * is executed.
+ */
+func (n *Program) exec(runtime *Runtime, context *context) error {
+  if n.extends == nil {
+    return n.containerNode.exec(runtime, context)
+  }
+  
+  if n.scoped {
+    context.push(make(frame))
+    defer context.pop()
+  }
+  for _, e := range n.subnodes {
+    switch e.(type) {
+      case *assignNode, *funcNode, *captureNode:
+        if err := e.exec(runtime, context); err != nil {
+          return err
+        }
+    }
+  }
+  
+  v, err := n.extends.name.exec(runtime, context)
+  if err != nil {
+    return err
+  }
+  name, ok := v.(string)
+  if !ok {
+    return runtimeErrorf(n.extends.name.src(), "Extends name must be a string: %v", displayType(reflect.ValueOf(v)))
+  }
+  
+  parent, err := runtime.load(n.extends.span, name)
+  if err != nil {
+    return err
+  }
+  
+  runtime.overrides = append(runtime.overrides, n.blocks)
+  runtime.includes = append(runtime.includes, name)
+  defer func() {
+    runtime.overrides = runtime.overrides[:len(runtime.overrides)-1]
+    runtime.includes = runtime.includes[:len(runtime.includes)-1]
+  }()
+  
+  return parent.exec(runtime, context)
+}
+
 /**
  * A container node
  */
 type containerNode struct {
   node
   subnodes []executable
+  scoped   bool // variables are declared in this container
 }
 
 /**
@@ -238,6 +429,10 @@ func (n *containerNode) exec(runtime *Runtime, context *context) error {
   if n.subnodes == nil {
     return nil // nothing to do
   }
+  if n.scoped {
+    context.push(make(frame))
+    defer context.pop()
+  }
   for _, e := range n.subnodes {
     err := e.exec(runtime, context)
     if err != nil {
@@ -258,11 +453,7 @@ type verbatimNode struct {
  * Execute
  */
 func (n *verbatimNode) exec(runtime *Runtime, context *context) error {
-  _, err := runtime.Stdout.Write([]byte(n.span.excerpt()))
-  if err != nil {
-    return err
-  }
-  return nil
+  return runtime.writeVerbatim(n.span.excerpt())
 }
 
 /**
@@ -317,14 +508,111 @@ func (n *ifNode) exec(runtime *Runtime, context *context) error {
   return nil
 }
 
+/**
+ * A switch node
+ */
+type switchNode struct {
+  node
+  expr  expression
+  cases []*caseNode
+}
+
+/**
+ * Execute
+ */
+func (n *switchNode) exec(runtime *Runtime, context *context) error {
+  var tag interface{}
+  var err error
+  
+  if n.expr != nil {
+    tag, err = n.expr.exec(runtime, context)
+    if err != nil {
+      return err
+    }
+  }
+  
+  match, deflt := -1, -1
+  outer: for i, c := range n.cases {
+    if c.exprs == nil {
+      deflt = i
+      continue
+    }
+    for _, e := range c.exprs {
+      v, err := e.exec(runtime, context)
+      if err != nil {
+        return err
+      }
+      var ok bool
+      if n.expr == nil {
+        ok, err = asBool(e.src(), v)
+        if err != nil {
+          return err
+        }
+      }else{
+        ok = valuesEqual(tag, v)
+      }
+      if ok {
+        match = i
+        break outer
+      }
+    }
+  }
+  
+  if match < 0 {
+    match = deflt
+  }
+  if match < 0 {
+    return nil
+  }
+  
+  for i := match; i < len(n.cases); i++ {
+    err := n.cases[i].body.exec(runtime, context)
+    if err == errFallthrough {
+      continue
+    }else if err == errBreak {
+      break
+    }else if err != nil {
+      return err
+    }
+    break
+  }
+  
+  return nil
+}
+
+/**
+ * A case in a switch. The default case has no expressions.
+ */
+type caseNode struct {
+  node
+  exprs []expression
+  body  executable
+}
+
+/**
+ * A fallthrough node
+ */
+type fallthroughNode struct {
+  node
+}
+
+/**
+ * Execute
+ */
+func (n *fallthroughNode) exec(runtime *Runtime, context *context) error {
+  return errFallthrough
+}
+
 /**
  * A for node
  */
 type forNode struct {
   node
-  vars  []expression
-  expr  expression
-  loop  executable
+  vars      []expression
+  expr      expression
+  loop      executable
+  otherwise executable // executed when the loop performs no iterations
+  last      bool       // the body refers to the Last field of the loop metadata
 }
 
 /**
@@ -337,78 +625,667 @@ func (n *forNode) exec(runtime *Runtime, context *context) error {
     return err
   }
   
+  iterated, err := n.execRange(runtime, context, items)
+  if err != nil {
+    return err
+  }
+  
+  if !iterated && n.otherwise != nil {
+    return n.otherwise.exec(runtime, context)
+  }
+  
+  return nil
+}
+
+/**
+ * Execute over the provided value, returning true if at least one iteration
+ * was performed
+ */
+func (n *forNode) execRange(runtime *Runtime, context *context, items interface{}) (bool, error) {
   value := reflect.ValueOf(items)
   deref, _ := derefValue(value)
   switch deref.Kind() {
+    case reflect.Invalid:
+      return false, nil // nil is an empty collection, so the else clause runs
     case reflect.Array:
       return n.execArray(runtime, context, deref)
     case reflect.Slice:
       return n.execArray(runtime, context, deref)
     case reflect.Map:
       return n.execMap(runtime, context, deref)
+    case reflect.String:
+      return n.execString(runtime, context, deref)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      return n.execInt(runtime, context, deref.Int())
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      if deref.Uint() > math.MaxInt64 {
+        return false, runtimeErrorf(n.expr.src(), "Cannot range over %v: too many iterations", deref.Uint())
+      }
+      return n.execInt(runtime, context, int64(deref.Uint()))
+    case reflect.Float32, reflect.Float64:
+      f := deref.Float()
+      if f != math.Trunc(f) {
+        return false, runtimeErrorf(n.expr.src(), "Cannot range over a non-integral number: %v", f)
+      }
+      return n.execInt(runtime, context, int64(f))
+    case reflect.Chan:
+      return n.execChan(runtime, context, deref)
+    case reflect.Func:
+      return n.execFunc(runtime, context, deref)
     default:
-      return runtimeErrorf(n.expr.src(), "Expression result is not iterable: %v", displayType(deref))
+      return false, runtimeErrorf(n.expr.src(), "Expression result is not iterable: %v", displayType(deref))
   }
   
 }
 
 /**
- * Execute
+ * Loop metadata, which is available in the body of a range loop that declares
+ * a third variable
  */
-func (n *forNode) execArray(runtime *Runtime, context *context, val reflect.Value) error {
-  frame := make(map[string]interface{})
-  context.push(frame)
-  defer context.pop()
+type Loop struct {
+  Index   int   // the index of the current iteration, from zero
+  Index1  int   // the index of the current iteration, from one
+  First   bool  // whether this is the first iteration
+  Last    bool  // whether this is the last iteration
+  Length  int   // the number of iterations, or -1 if it is not known in advance
+  Even    bool  // whether the index is even
+  Odd     bool  // whether the index is odd
+  Parent  *Loop // the metadata of the enclosing loop, if any
+}
+
+/**
+ * The state of a range loop being executed
+ */
+type forState struct {
+  frame   frame
+  parent  *Loop
+  length  int
+}
+
+/**
+ * Begin executing a range loop by pushing its frame
+ */
+func (n *forNode) begin(context *context, length int) *forState {
+  state := &forState{make(frame), context.loop, length}
+  context.push(state.frame)
+  return state
+}
+
+/**
+ * Finish executing a range loop by popping its frame
+ */
+func (n *forNode) end(context *context, state *forState) {
+  context.loop = state.parent
+  context.pop()
+}
+
+/**
+ * Execute a single iteration of the loop with the provided key and value,
+ * returning false if the loop should stop
+ */
+func (n *forNode) iterate(runtime *Runtime, context *context, state *forState, i int, last bool, k, v interface{}) (bool, error) {
+  if err := runtime.checkIterations(n.span, i); err != nil {
+    return false, err
+  }
+  
+  if len(n.vars) == 1 {
+    state.frame[n.vars[0].(*identNode).ident] = v
+  }else{
+    state.frame[n.vars[0].(*identNode).ident] = k
+    state.frame[n.vars[1].(*identNode).ident] = v
+  }
   
+  context.loop = &Loop{
+    Index:  i,
+    Index1: i + 1,
+    First:  i == 0,
+    Last:   last,
+    Length: state.length,
+    Even:   i % 2 == 0,
+    Odd:    i % 2 != 0,
+    Parent: state.parent,
+  }
+  if len(n.vars) > 2 {
+    state.frame[n.vars[2].(*identNode).ident] = context.loop
+  }
+  
+  err := n.loop.exec(runtime, context)
+  if err == errBreak {
+    return false, nil
+  }else if err == errContinue {
+    return true, nil
+  }else if err != nil {
+    return false, err
+  }
+  
+  return true, nil
+}
+
+/**
+ * Execute
+ */
+func (n *forNode) execArray(runtime *Runtime, context *context, val reflect.Value) (bool, error) {
   l := val.Len()
+  state := n.begin(context, l)
+  defer n.end(context, state)
+  
   for i := 0; i < l; i++ {
-    v := val.Index(i)
-    
-    if len(n.vars) == 1 {
-      frame[n.vars[0].(*identNode).ident] = v.Interface()
-    }else{
-      frame[n.vars[0].(*identNode).ident] = i
-      frame[n.vars[1].(*identNode).ident] = v.Interface()
+    more, err := n.iterate(runtime, context, state, i, i == l - 1, i, val.Index(i).Interface())
+    if err != nil {
+      return false, err
+    }else if !more {
+      break
     }
-    
-    err := n.loop.exec(runtime, context)
-    if err == errBreak {
+  }
+  
+  return l > 0, nil
+}
+
+/**
+ * Execute
+ */
+func (n *forNode) execMap(runtime *Runtime, context *context, val reflect.Value) (bool, error) {
+  keys := val.MapKeys()
+  if !runtime.UnsortedMaps {
+    sortKeys(keys)
+  }
+  
+  l := len(keys)
+  state := n.begin(context, l)
+  defer n.end(context, state)
+  
+  for i, k := range keys {
+    more, err := n.iterate(runtime, context, state, i, i == l - 1, k.Interface(), val.MapIndex(k).Interface())
+    if err != nil {
+      return false, err
+    }else if !more {
       break
-    }else if err == errContinue {
-      continue
-    }else if err != nil {
+    }
+  }
+  
+  return l > 0, nil
+}
+
+/**
+ * Execute over the characters in a string. The key is the byte offset of each
+ * character and the value is the character as a string.
+ */
+func (n *forNode) execString(runtime *Runtime, context *context, val reflect.Value) (bool, error) {
+  str := val.String()
+  l := utf8.RuneCountInString(str)
+  state := n.begin(context, l)
+  defer n.end(context, state)
+  
+  i := 0
+  for o, r := range str {
+    more, err := n.iterate(runtime, context, state, i, i == l - 1, o, string(r))
+    if err != nil {
+      return false, err
+    }else if !more {
+      break
+    }
+    i++
+  }
+  
+  return l > 0, nil
+}
+
+/**
+ * Execute over the integers from zero up to, but not including, the provided value
+ */
+func (n *forNode) execInt(runtime *Runtime, context *context, val int64) (bool, error) {
+  state := n.begin(context, int(max(val, 0)))
+  defer n.end(context, state)
+  
+  for i := 0; int64(i) < val; i++ {
+    more, err := n.iterate(runtime, context, state, i, int64(i) == val - 1, i, i)
+    if err != nil {
+      return false, err
+    }else if !more {
+      break
+    }
+  }
+  
+  return val > 0, nil
+}
+
+/**
+ * Determine whether the loop declares a key variable, as opposed to a value
+ * alone or a value and loop metadata with the key discarded
+ */
+func (n *forNode) keyed() bool {
+  switch len(n.vars) {
+    case 1:
+      return false
+    case 3:
+      return n.vars[0].(*identNode).ident != "_"
+    default:
+      return true
+  }
+}
+
+/**
+ * Execute over the values received from a channel until it is closed. When
+ * the body of the loop refers to the Last field of the loop metadata, each
+ * value is received before the body is executed for the previous one in order
+ * to determine which iteration is the last; otherwise Last is always false.
+ */
+func (n *forNode) execChan(runtime *Runtime, context *context, val reflect.Value) (bool, error) {
+  if val.Type().ChanDir() & reflect.RecvDir == 0 {
+    return false, runtimeErrorf(n.expr.src(), "Cannot range over a send-only channel: %v", displayType(val))
+  }
+  if n.keyed() {
+    return false, runtimeErrorf(n.expr.src(), "Range over a channel permits only one variable")
+  }
+  
+  state := n.begin(context, -1)
+  defer n.end(context, state)
+  
+  if !n.last {
+    for i := 0; ; i++ {
+      v, ok := val.Recv()
+      if !ok {
+        return i > 0, nil
+      }
+      cont, err := n.iterate(runtime, context, state, i, false, nil, v.Interface())
+      if err != nil {
+        return false, err
+      }else if !cont {
+        return true, nil
+      }
+    }
+  }
+  
+  v, ok := val.Recv()
+  if !ok {
+    return false, nil
+  }
+  
+  for i := 0; ; i++ {
+    next, more := val.Recv()
+    cont, err := n.iterate(runtime, context, state, i, !more, nil, v.Interface())
+    if err != nil {
+      return false, err
+    }else if !cont || !more {
+      break
+    }
+    v = next
+  }
+  
+  return true, nil
+}
+
+/**
+ * Execute over the values produced by an iterator function, either an iter.Seq
+ * or an iter.Seq2. Like maps, when an iter.Seq2 is ranged over with a single
+ * variable it receives the value. As with channels, each element is produced
+ * before the body of the loop is executed for the previous one only when the
+ * body refers to the Last field of the loop metadata.
+ */
+func (n *forNode) execFunc(runtime *Runtime, context *context, val reflect.Value) (bool, error) {
+  if !val.Type().CanSeq() && !val.Type().CanSeq2() {
+    return false, runtimeErrorf(n.expr.src(), "Function is not an iterator: %v", displayType(val))
+  }
+  if val.Type().CanSeq() && n.keyed() {
+    return false, runtimeErrorf(n.expr.src(), "Range over %v permits only one variable", displayType(val))
+  }
+  
+  state := n.begin(context, -1)
+  defer n.end(context, state)
+  
+  var i int
+  var pk, pv interface{}
+  var pending, more bool = false, true
+  var err error
+  
+  // handle an element, returning false if iteration should stop
+  element := func(k, v interface{}) bool {
+    if !n.last {
+      more, err = n.iterate(runtime, context, state, i, false, k, v)
+      i++
+      return err == nil && more
+    }
+    if pending {
+      more, err = n.iterate(runtime, context, state, i, false, pk, pv)
+      if err != nil || !more {
+        return false
+      }
+      i++
+    }
+    pk, pv, pending = k, v, true
+    return true
+  }
+  
+  if val.Type().CanSeq() {
+    for v := range val.Seq() {
+      if !element(i, v.Interface()) {
+        break
+      }
+    }
+  }else{
+    for k, v := range val.Seq2() {
+      if !element(k.Interface(), v.Interface()) {
+        break
+      }
+    }
+  }
+  if err != nil {
+    return false, err
+  }
+  
+  if pending && more {
+    _, err = n.iterate(runtime, context, state, i, true, pk, pv)
+    if err != nil {
+      return false, err
+    }
+  }
+  
+  return pending || i > 0, nil
+}
+
+/**
+ * An include node
+ */
+type includeNode struct {
+  node
+  name    expression
+  context expression
+}
+
+/**
+ * Execute
+ */
+func (n *includeNode) exec(runtime *Runtime, context *context) error {
+  
+  v, err := n.name.exec(runtime, context)
+  if err != nil {
+    return err
+  }
+  name, ok := v.(string)
+  if !ok {
+    return runtimeErrorf(n.name.src(), "Include name must be a string: %v", displayType(reflect.ValueOf(v)))
+  }
+  
+  prog, err := runtime.load(n.span, name)
+  if err != nil {
+    return err
+  }
+  
+  sub := context
+  if n.context != nil {
+    v, err := n.context.exec(runtime, context)
+    if err != nil {
       return err
     }
+    sub = newContext(v)
   }
   
+  // included templates do not see the blocks of the including template
+  includes, overrides, supers := runtime.includes, runtime.overrides, runtime.supers
+  runtime.includes, runtime.overrides, runtime.supers = append(includes, name), nil, nil
+  defer func() { runtime.includes, runtime.overrides, runtime.supers = includes, overrides, supers }()
+  
+  return prog.exec(runtime, sub)
+}
+
+/**
+ * An extends node
+ */
+type extendsNode struct {
+  node
+  name  expression
+}
+
+/**
+ * Execute. The parent is executed by the program, so this does nothing.
+ */
+func (n *extendsNode) exec(runtime *Runtime, context *context) error {
   return nil
 }
 
+/**
+ * A named block node
+ */
+type blockNode struct {
+  node
+  name  string
+  body  executable
+}
+
+/**
+ * Execute. The most derived override of this block is executed, with the
+ * rest of the chain available to @super().
+ */
+func (n *blockNode) exec(runtime *Runtime, context *context) error {
+  var found bool
+  chain := make([]*blockNode, 0, len(runtime.overrides) + 1)
+  for _, e := range runtime.overrides {
+    if b, ok := e[n.name]; ok {
+      chain = append(chain, b)
+      found = found || b == n
+    }
+  }
+  if !found {
+    chain = append(chain, n)
+  }
+  return runtime.execBlocks(chain, context)
+}
+
+/**
+ * A super node
+ */
+type superNode struct {
+  node
+}
+
+/**
+ * Execute the next block in the current chain, if there is one
+ */
+func (n *superNode) exec(runtime *Runtime, context *context) error {
+  if l := len(runtime.supers); l > 0 {
+    if chain := runtime.supers[l-1]; len(chain) > 1 {
+      return runtime.execBlocks(chain[1:], context)
+    }
+  }
+  return nil
+}
+
+/**
+ * A for node with init, condition and post clauses, any of which may be omitted
+ */
+type forClauseNode struct {
+  node
+  init      executable
+  cond      expression
+  post      executable
+  loop      executable
+  otherwise executable // executed when the loop performs no iterations
+}
+
 /**
  * Execute
  */
-func (n *forNode) execMap(runtime *Runtime, context *context, val reflect.Value) error {
-  frame := make(map[string]interface{})
-  context.push(frame)
+func (n *forClauseNode) exec(runtime *Runtime, context *context) error {
+  context.push(make(frame))
   defer context.pop()
   
-  keys := val.MapKeys()
-  for _, k := range keys {
-    v := val.MapIndex(k)
+  if n.init != nil {
+    err := n.init.exec(runtime, context)
+    if err != nil {
+      return err
+    }
+  }
+  
+  var iterated bool
+  for i := 0; ; i++ {
+    if err := runtime.checkIterations(n.span, i); err != nil {
+      return err
+    }
     
-    if len(n.vars) == 1 {
-      frame[n.vars[0].(*identNode).ident] = v.Interface()
-    }else{
-      frame[n.vars[0].(*identNode).ident] = k.Interface()
-      frame[n.vars[1].(*identNode).ident] = v.Interface()
+    if n.cond != nil {
+      v, err := n.cond.exec(runtime, context)
+      if err != nil {
+        return err
+      }
+      ok, err := asBool(n.cond.src(), v)
+      if err != nil {
+        return err
+      }else if !ok {
+        break
+      }
     }
     
+    iterated = true
     err := n.loop.exec(runtime, context)
     if err == errBreak {
       break
-    }else if err == errContinue {
-      continue
-    }else if err != nil {
+    }else if err != nil && err != errContinue {
+      return err
+    }
+    
+    if n.post != nil {
+      err := n.post.exec(runtime, context)
+      if err != nil {
+        return err
+      }
+    }
+  }
+  
+  if !iterated && n.otherwise != nil {
+    return n.otherwise.exec(runtime, context)
+  }
+  
+  return nil
+}
+
+/**
+ * The maximum depth of template function calls
+ */
+const maxCallDepth = 1000
+
+/**
+ * A function definition node
+ */
+type funcNode struct {
+  node
+  name    string
+  params  []string
+  body    executable
+}
+
+/**
+ * Execute
+ */
+func (n *funcNode) exec(runtime *Runtime, context *context) error {
+  // the function captures the variables in scope where it is defined; the
+  // stack is copied since its storage is reused as frames are pushed and popped
+  stack := make([]interface{}, len(context.stack))
+  copy(stack, context.stack)
+  return context.declare(n.span, n.name, &function{n, stack})
+}
+
+/**
+ * A function defined in a template. When called, its output is written
+ * to the runtime's output.
+ */
+type function struct {
+  node  *funcNode
+  stack []interface{}
+}
+
+/**
+ * Call a function
+ */
+func (f *function) call(runtime *Runtime, s span, args []interface{}) error {
+  if len(args) != len(f.node.params) {
+    return runtimeErrorf(s, "Function %v takes %v arguments but is given %v", f.node.name, len(f.node.params), len(args))
+  }
+  if runtime.calls >= maxCallDepth {
+    return runtimeErrorf(s, "Function calls exceed the maximum depth of %d", maxCallDepth)
+  }
+  
+  runtime.calls++
+  defer func() { runtime.calls-- }()
+  
+  params := make(frame)
+  for i, e := range f.node.params {
+    params[e] = args[i]
+  }
+  
+  stack := make([]interface{}, len(f.stack), len(f.stack) + 8)
+  copy(stack, f.stack)
+  context := &context{stack, nil}
+  context.push(params)
+  
+  return f.node.body.exec(runtime, context)
+}
+
+/**
+ * A capture node, which declares a variable with the output of a block
+ */
+type captureNode struct {
+  node
+  name  string
+  body  executable
+}
+
+/**
+ * Execute
+ */
+func (n *captureNode) exec(runtime *Runtime, context *context) error {
+  buf := &bytes.Buffer{}
+  
+  // output is captured with its own escaping context, since it will be
+  // written out elsewhere
+  stdout, html := runtime.Stdout, runtime.html
+  runtime.Stdout, runtime.html = buf, nil
+  err := n.body.exec(runtime, context)
+  runtime.Stdout, runtime.html = stdout, html
+  if err != nil {
+    return err
+  }
+  
+  // escaped output is trusted when it is written out again
+  if runtime.Escape == EscapeHTML {
+    return context.declare(n.span, n.name, SafeHTML(buf.String()))
+  }else{
+    return context.declare(n.span, n.name, buf.String())
+  }
+}
+
+/**
+ * An assignment node, which either declares or assigns variables
+ */
+type assignNode struct {
+  node
+  declare bool
+  names   []string
+  values  []expression
+}
+
+/**
+ * Execute
+ */
+func (n *assignNode) exec(runtime *Runtime, context *context) error {
+  
+  // evaluate all the values before assigning any of them
+  vals := make([]interface{}, len(n.values))
+  for i, e := range n.values {
+    v, err := e.exec(runtime, context)
+    if err != nil {
+      return err
+    }
+    vals[i] = v
+  }
+  
+  for i, e := range n.names {
+    var err error
+    if n.declare {
+      err = context.declare(n.span, e, vals[i])
+    }else{
+      err = context.assign(n.span, e, vals[i])
+    }
+    if err != nil {
       return err
     }
   }
@@ -443,42 +1320,110 @@ func (n *exprNode) exec(runtime *Runtime, context *context) error {
       out = v
     case []byte:
       out = string(v)
+    case SafeHTML:
+      out = string(v)
+    case SafeURL:
+      out = string(v)
+    case SafeJS:
+      out = string(v)
+    case SafeCSS:
+      out = string(v)
     default:
       out = fmt.Sprintf("%v", v)
   }
-  
-  _, err = runtime.Stdout.Write([]byte(out))
+  
+  // trusted values are recognized by the escaper
+  if runtime.Escape == EscapeHTML {
+    out = runtime.htmlContext().escape(res, out)
+  }
+  
+  _, err = io.WriteString(runtime.Stdout, out)
+  if err != nil {
+    return err
+  }
+  
+  return nil
+}
+
+/**
+ * A logical NOT node
+ */
+type logicalNotNode struct {
+  node
+  right expression
+}
+
+/**
+ * Execute
+ */
+func (n *logicalNotNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  
+  rvi, err := n.right.exec(runtime, context)
+  if err != nil {
+    return nil, err
+  }
+  
+  rv, err := asBool(n.right.src(), rvi)
+  if err != nil {
+    return nil, err
+  }
+  
+  return !rv, nil
+}
+
+/**
+ * A conditional expression node
+ */
+type conditionalNode struct {
+  node
+  cond, iftrue, iffalse expression
+}
+
+/**
+ * Execute
+ */
+func (n *conditionalNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  
+  cvi, err := n.cond.exec(runtime, context)
+  if err != nil {
+    return nil, err
+  }
+  cv, err := asBool(n.cond.src(), cvi)
   if err != nil {
-    return err
+    return nil, err
   }
   
-  return nil
+  if cv {
+    return n.iftrue.exec(runtime, context)
+  }else{
+    return n.iffalse.exec(runtime, context)
+  }
 }
 
 /**
- * A logical NOT node
+ * A null-coalescing node, which evaluates to its right operand only when its
+ * left operand is nil
  */
-type logicalNotNode struct {
+type coalesceNode struct {
   node
-  right expression
+  left, right expression
 }
 
 /**
  * Execute
  */
-func (n *logicalNotNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+func (n *coalesceNode) exec(runtime *Runtime, context *context) (interface{}, error) {
   
-  rvi, err := n.right.exec(runtime, context)
+  lvi, err := n.left.exec(runtime, context)
   if err != nil {
     return nil, err
   }
   
-  rv, err := asBool(n.right.src(), rvi)
-  if err != nil {
-    return nil, err
+  if !isNil(lvi) {
+    return lvi, nil
   }
   
-  return !rv, nil
+  return n.right.exec(runtime, context)
 }
 
 /**
@@ -575,31 +1520,106 @@ func (n *arithmeticNode) exec(runtime *Runtime, context *context) (interface{},
   if err != nil {
     return nil, err
   }
-  lv, err := asNumber(n.left.src(), lvi)
+  rvi, err := n.right.exec(runtime, context)
+  if err != nil {
+    return nil, err
+  }
+  
+  switch n.op.which {
+    case tokenAmp, tokenCaret, tokenAndNot, tokenShiftLeft, tokenShiftRight:
+      return n.execBitwise(lvi, rvi)
+  }
+  
+  if isBigNumber(lvi) || isBigNumber(rvi) {
+    res, err := bigArithmetic(n.op.which, exactOperand(n.left, lvi), exactOperand(n.right, rvi))
+    if err != nil {
+      return nil, runtimeErrorf(n.span, "%v", err)
+    }
+    return res, nil
+  }
+  
+  lv, err := numericValue(n.left.src(), lvi)
+  if err != nil {
+    return nil, err
+  }
+  rv, err := numericValue(n.right.src(), rvi)
+  if err != nil {
+    return nil, err
+  }
+  
+  res, err := arithmetic(n.op.which, lv, rv)
+  if err != nil {
+    return nil, runtimeErrorf(n.span, "%v: %v %v %v", err, lvi, n.op.which, rvi)
+  }
+  
+  return res, nil
+}
+
+/**
+ * Execute a bitwise operation, which requires integer operands
+ */
+func (n *arithmeticNode) execBitwise(lvi, rvi interface{}) (interface{}, error) {
+  
+  lv, err := integerValue(n.left.src(), lvi)
+  if err != nil {
+    return nil, err
+  }
+  rv, err := integerValue(n.right.src(), rvi)
   if err != nil {
     return nil, err
   }
   
+  res, err := bitwise(n.op.which, lv, rv)
+  if err != nil {
+    return nil, runtimeErrorf(n.span, "%v: %v %v %v", err, lvi, n.op.which, rvi)
+  }
+  
+  return res, nil
+}
+
+/**
+ * A unary expression node
+ */
+type unaryNode struct {
+  node
+  op    token
+  right expression
+}
+
+/**
+ * Execute
+ */
+func (n *unaryNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  
   rvi, err := n.right.exec(runtime, context)
   if err != nil {
     return nil, err
   }
-  rv, err := asNumber(n.right.src(), rvi)
+  if isBigNumber(rvi) {
+    if n.op.which == tokenAdd {
+      return rvi, nil
+    }
+    res, err := bigNegate(rvi)
+    if err != nil {
+      return nil, runtimeErrorf(n.span, "%v", err)
+    }
+    return res, nil
+  }
+  
+  rv, err := numericValue(n.right.src(), rvi)
   if err != nil {
     return nil, err
   }
   
   switch n.op.which {
     case tokenAdd:
-      return lv + rv, nil
+      return normalizeNumber(rv), nil
     case tokenSub:
-      return lv - rv, nil
-    case tokenMul:
-      return lv * rv, nil
-    case tokenDiv:
-      return lv / rv, nil
-    case tokenMod: // truncates to int
-      return int64(lv) % int64(rv), nil
+      res, err := negate(rv)
+      if err != nil {
+        return nil, runtimeErrorf(n.span, "%v: -%v", err, rvi)
+      }
+      return res, nil
     default:
       return nil, runtimeErrorf(n.span, "Invalid operator: %v", n.op)
   }
@@ -628,36 +1648,49 @@ func (n *relationalNode) exec(runtime *Runtime, context *context) (interface{},
   if err != nil {
     return nil, err
   }
+  if isBigNumber(lvi) || isBigNumber(rvi) {
+    lvi, rvi = exactOperand(n.left, lvi), exactOperand(n.right, rvi)
+  }
   
   switch n.op.which {
     case tokenEqual:
-      return lvi == rvi, nil
+      return valuesEqual(lvi, rvi), nil
     case tokenNotEqual:
-      return lvi != rvi, nil
+      return !valuesEqual(lvi, rvi), nil
+  }
+  
+  if isBigNumber(lvi) || isBigNumber(rvi) {
+    c, err := bigCompare(lvi, rvi)
+    if err != nil {
+      return nil, runtimeErrorf(n.span, "%v", err)
+    }
+    switch n.op.which {
+      case tokenLess:
+        return c < 0, nil
+      case tokenGreater:
+        return c > 0, nil
+      case tokenLessEqual:
+        return c <= 0, nil
+      case tokenGreaterEqual:
+        return c >= 0, nil
+    }
   }
   
-  lv, err := asNumber(n.left.src(), lvi)
+  lv, err := numericValue(n.left.src(), lvi)
   if err != nil {
     return nil, err
   }
-  rv, err := asNumber(n.right.src(), rvi)
+  rv, err := numericValue(n.right.src(), rvi)
   if err != nil {
     return nil, err
   }
   
-  switch n.op.which {
-    case tokenLess:
-      return lv < rv, nil
-    case tokenGreater:
-      return lv > rv, nil
-    case tokenLessEqual:
-      return lv <= rv, nil
-    case tokenGreaterEqual:
-      return lv >= rv, nil
-    default:
-      return nil, runtimeErrorf(n.span, "Invalid operator: %v", n.op)
+  res, err := compareOrder(n.op.which, lv, rv)
+  if err != nil {
+    return nil, runtimeErrorf(n.span, "%v", err)
   }
   
+  return res, nil
 }
 
 /**
@@ -666,6 +1699,7 @@ func (n *relationalNode) exec(runtime *Runtime, context *context) (interface{},
 type derefNode struct {
   node
   left, right expression
+  safe        bool // evaluates to nil when the left operand is nil
 }
 
 /**
@@ -677,6 +1711,9 @@ func (n *derefNode) exec(runtime *Runtime, context *context) (interface{}, error
   if err != nil {
     return nil, err
   }
+  if (n.safe || runtime.NilDeref) && isNil(v) {
+    return nil, nil
+  }
   
   context.push(v)
   defer context.pop()
@@ -700,6 +1737,7 @@ func (n *derefNode) exec(runtime *Runtime, context *context) (interface{}, error
 type indexNode struct {
   node
   left, right expression
+  safe        bool // evaluates to nil when the left operand is nil
 }
 
 /**
@@ -711,6 +1749,9 @@ func (n *indexNode) exec(runtime *Runtime, context *context) (interface{}, error
   if err != nil {
     return nil, err
   }
+  if (n.safe || runtime.NilDeref) && isNil(val) {
+    return nil, nil
+  }
   
   sub, err := n.right.exec(runtime, context)
   if err != nil {
@@ -733,6 +1774,8 @@ func (n *indexNode) exec(runtime *Runtime, context *context) (interface{}, error
       return n.execArray(runtime, context, deref, prop)
     case reflect.Map:
       return n.execMap(runtime, context, deref, prop)
+    case reflect.String:
+      return n.execString(runtime, context, deref, prop)
     default:
       return nil, runtimeErrorf(n.span, "Expression result is not indexable: %v", displayType(deref))
   }
@@ -757,6 +1800,34 @@ func (n *indexNode) execArray(runtime *Runtime, context *context, val reflect.Va
   return val.Index(int(i)).Interface(), nil
 }
 
+/**
+ * Execute on a string. The character at the index is produced as a string.
+ */
+func (n *indexNode) execString(runtime *Runtime, context *context, val reflect.Value, index reflect.Value) (interface{}, error) {
+  
+  i, err := asNumberValue(n.right.src(), index)
+  if err != nil {
+    return nil, err
+  }
+  if i != math.Trunc(i) {
+    return nil, runtimeErrorf(n.right.src(), "Index is not an integer: %v", i)
+  }
+  
+  if runtime.RuneStrings {
+    r := []rune(val.String())
+    if int(i) < 0 || int(i) >= len(r) {
+      return nil, runtimeErrorf(n.right.src(), "Index out-of-bounds: %v", i)
+    }
+    return string(r[int(i)]), nil
+  }
+  
+  str := val.String()
+  if int(i) < 0 || int(i) >= len(str) {
+    return nil, runtimeErrorf(n.right.src(), "Index out-of-bounds: %v", i)
+  }
+  return str[int(i):int(i)+1], nil
+}
+
 /**
  * Execute
  */
@@ -766,7 +1837,186 @@ func (n *indexNode) execMap(runtime *Runtime, context *context, val reflect.Valu
     return nil, runtimeErrorf(n.span, "Expression result is not assignable to map key type: %v != %v", key.Type(), val.Type().Key())
   }
   
-  return val.MapIndex(key).Interface(), nil
+  res := val.MapIndex(key)
+  if !res.IsValid() {
+    return nil, nil // not found
+  }
+  
+  return res.Interface(), nil
+}
+
+/**
+ * A list literal expression node
+ */
+type listNode struct {
+  node
+  items []expression
+}
+
+/**
+ * Execute
+ */
+func (n *listNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  res := make([]interface{}, len(n.items))
+  for i, e := range n.items {
+    v, err := e.exec(runtime, context)
+    if err != nil {
+      return nil, err
+    }
+    res[i] = v
+  }
+  return res, nil
+}
+
+/**
+ * A map literal expression node
+ */
+type mapNode struct {
+  node
+  keys []expression
+  vals []expression
+}
+
+/**
+ * Execute
+ */
+func (n *mapNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  res := make(map[string]interface{}, len(n.keys))
+  for i, e := range n.keys {
+    k, err := e.exec(runtime, context)
+    if err != nil {
+      return nil, err
+    }
+    s, ok := k.(string)
+    if !ok {
+      return nil, runtimeErrorf(e.src(), "Map key is not a string: %v", displayType(reflect.ValueOf(k)))
+    }
+    if _, ok := res[s]; ok {
+      return nil, runtimeErrorf(e.src(), "Duplicate key in map literal: %q", s)
+    }
+    v, err := n.vals[i].exec(runtime, context)
+    if err != nil {
+      return nil, err
+    }
+    res[s] = v
+  }
+  return res, nil
+}
+
+/**
+ * A slice expression node
+ */
+type sliceNode struct {
+  node
+  left    expression
+  lo, hi  expression // either bound may be nil
+  sub     span       // the span of the subscript, including its brackets
+  safe    bool       // evaluates to nil when the left operand is nil
+}
+
+/**
+ * Execute
+ */
+func (n *sliceNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  
+  val, err := n.left.exec(runtime, context)
+  if err != nil {
+    return nil, err
+  }
+  if (n.safe || runtime.NilDeref) && isNil(val) {
+    return nil, nil
+  }
+  
+  var runes bool
+  deref, _ := derefValue(reflect.ValueOf(val))
+  switch deref.Kind() {
+    case reflect.Slice:
+      // valid
+    case reflect.Array:
+      if !deref.CanAddr() { // arrays must be addressable to be sliced
+        a := reflect.New(deref.Type()).Elem()
+        a.Set(deref)
+        deref = a
+      }
+    case reflect.String:
+      if runtime.RuneStrings {
+        deref = reflect.ValueOf([]rune(deref.String()))
+        runes = true
+      }
+    default:
+      return nil, runtimeErrorf(n.span, "Expression result cannot be sliced: %v", displayType(deref))
+  }
+  
+  l := deref.Len()
+  lo, err := n.bound(runtime, context, n.lo, 0)
+  if err != nil {
+    return nil, err
+  }
+  hi, err := n.bound(runtime, context, n.hi, l)
+  if err != nil {
+    return nil, err
+  }
+  
+  if lo < 0 || hi > l || lo > hi {
+    return nil, runtimeErrorf(n.sub, "Slice bounds out-of-range: [%d:%d] with length %d", lo, hi, l)
+  }
+  
+  res := deref.Slice(lo, hi)
+  if runes {
+    return string(res.Interface().([]rune)), nil
+  }
+  
+  return res.Interface(), nil
+}
+
+/**
+ * Evaluate a slice bound, which produces the provided default if it is omitted
+ */
+func (n *sliceNode) bound(runtime *Runtime, context *context, e expression, def int) (int, error) {
+  if e == nil {
+    return def, nil
+  }
+  
+  v, err := e.exec(runtime, context)
+  if err != nil {
+    return 0, err
+  }
+  
+  f, err := asNumber(e.src(), v)
+  if err != nil {
+    return 0, err
+  }
+  if f != math.Trunc(f) {
+    return 0, runtimeErrorf(e.src(), "Slice bound is not an integer: %v", f)
+  }
+  
+  return int(f), nil
+}
+
+/**
+ * A pipeline stage expression node. The result of the left expression is
+ * provided as the first argument to the named function.
+ */
+type pipeNode struct {
+  node
+  op      token
+  left    expression
+  right   *identNode
+  params  []expression // nil if the stage has no argument list
+}
+
+/**
+ * Execute
+ */
+func (n *pipeNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  
+  lv, err := n.left.exec(runtime, context)
+  if err != nil {
+    return nil, err
+  }
+  left := &literalNode{node{n.left.src(), &n.op}, lv}
+  
+  return (&invokeNode{n.node, nil, n.right, append([]expression{left}, n.params...)}).exec(runtime, context)
 }
 
 /**
@@ -814,6 +2064,9 @@ func (n *invokeNode) exec(runtime *Runtime, context *context) (interface{}, erro
     }else if liv == nil {
       return nil, runtimeErrorf(n.span, "No such function '%v'", name)
     }
+    if fn, ok := liv.(*function); ok {
+      return nil, n.callFunction(runtime, context, fn)
+    }
     f = reflect.ValueOf(liv)
     if f.Kind() != reflect.Func {
       return nil, runtimeErrorf(n.span, "Variable '%v' is not a function", name)
@@ -858,7 +2111,11 @@ func (n *invokeNode) exec(runtime *Runtime, context *context) (interface{}, erro
       return nil, runtimeErrorf(e.src(), "Invalid parameter")
     }
     if !a.Type().AssignableTo(t) {
-      return nil, runtimeErrorf(e.src(), "Cannot use %v as %v", displayType(a), t.String())
+      c, ok := convertNumber(a, t)
+      if !ok {
+        return nil, runtimeErrorf(e.src(), "Cannot use %v as %v", displayType(a), t.String())
+      }
+      a = c
     }
     args = append(args, a)
     in++
@@ -896,6 +2153,21 @@ func (n *invokeNode) exec(runtime *Runtime, context *context) (interface{}, erro
   return nil, nil
 }
 
+/**
+ * Call a function defined in a template
+ */
+func (n *invokeNode) callFunction(runtime *Runtime, context *context, fn *function) error {
+  args := make([]interface{}, len(n.params))
+  for i, e := range n.params {
+    v, err := e.exec(runtime, context)
+    if err != nil {
+      return err
+    }
+    args[i] = v
+  }
+  return fn.call(runtime, n.span, args)
+}
+
 /**
  * An identifier expression node
  */
@@ -926,6 +2198,23 @@ func (n *literalNode) exec(runtime *Runtime, context *context) (interface{}, err
   return n.value, nil
 }
 
+/**
+ * A numeric literal expression node
+ */
+type numberNode struct {
+  node
+  value interface{} // int64, uint64 or float64
+  kind  numericType
+  exact *big.Rat    // the exact value of a decimal literal, which is otherwise a float64
+}
+
+/**
+ * Execute
+ */
+func (n *numberNode) exec(runtime *Runtime, context *context) (interface{}, error) {
+  return n.value, nil
+}
+
 /**
  * A break expression node
  */
@@ -973,6 +2262,39 @@ func asBool(s span, value interface{}) (bool, error) {
   }
 }
 
+/**
+ * Obtain an interface value as an integer reflect value, which is either
+ * signed or unsigned. Floating point values are accepted if they have no
+ * fractional part and can be represented as an int64.
+ */
+func integerValue(s span, v interface{}) (reflect.Value, error) {
+  rv := reflect.ValueOf(v)
+  switch rv.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      return rv, nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      return rv, nil
+    case reflect.Float32, reflect.Float64:
+      if f := rv.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+        return reflect.ValueOf(int64(f)), nil
+      }
+      return reflect.Value{}, runtimeErrorf(s, "Cannot use %v as an integer", rv.Float())
+    default:
+      return reflect.Value{}, runtimeErrorf(s, "Cannot cast %v to integer", displayType(rv))
+  }
+}
+
+/**
+ * Obtain an interface value as a numeric reflect value
+ */
+func numericValue(s span, v interface{}) (reflect.Value, error) {
+  rv := reflect.ValueOf(v)
+  if !isNumericKind(rv.Kind()) {
+    return reflect.Value{}, runtimeErrorf(s, "Cannot cast %v to numeric", displayType(rv))
+  }
+  return rv, nil
+}
+
 /**
  * Obtain an interface value as a number
  */
@@ -996,6 +2318,32 @@ func asNumberValue(s span, v reflect.Value) (float64, error) {
   }
 }
 
+/**
+ * Determine if two values are equal. Numbers of any type are compared by
+ * value; other values are equal if they are comparable and identical.
+ */
+func valuesEqual(a, b interface{}) bool {
+  if a == nil || b == nil {
+    return a == nil && b == nil
+  }
+  
+  if isBigNumber(a) || isBigNumber(b) {
+    if c, err := bigCompare(a, b); err == nil {
+      return c == 0
+    }
+  }
+  
+  av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+  if isNumericKind(av.Kind()) && isNumericKind(bv.Kind()) {
+    return compareNumbers(av, bv) == 0
+  }
+  if !av.Comparable() || !bv.Comparable() {
+    return false
+  }
+  
+  return a == b
+}
+
 /**
  * Dereference
  */
@@ -106,6 +106,15 @@ const (
   numericFloat
 )
 
+/**
+ * A numeric literal, which is the value of a number token
+ */
+type numberLiteral struct {
+  value interface{} // int64, uint64 or float64
+  kind  numericType
+  text  string      // the literal as it appears in the source
+}
+
 /**
  * Token type
  */
@@ -133,16 +142,30 @@ const (
   tokenFor
   tokenBreak
   tokenContinue
+  tokenSwitch
+  tokenCase
+  tokenDefault
+  tokenFallthrough
+  tokenFunc
+  tokenCapture
+  tokenMap
   
   tokenTrue
   tokenFalse
   tokenNil
   tokenRange
   
+  tokenInclude
+  tokenExtends
+  tokenBlockDecl
+  tokenSuper
+  
   tokenLParen           = '('
   tokenRParen           = ')'
   tokenLBracket         = '['
   tokenRBracket         = ']'
+  tokenLBrace           = '{'
+  tokenRBrace           = '}'
   tokenDot              = '.'
   tokenComma            = ','
   tokenSemi             = ';'
@@ -158,6 +181,8 @@ const (
   tokenBang             = '!'
   tokenAmp              = '&'
   tokenPipe             = '|'
+  tokenQuestion         = '?'
+  tokenCaret            = '^'
   
   tokenPrefixAdd        = 1 << 16
   tokenInc              = tokenPrefixAdd | '+'
@@ -167,10 +192,22 @@ const (
   
   tokenPrefixAmp        = 1 << 18
   tokenLogicalAnd       = tokenPrefixAmp | '&'
+  tokenAndNot           = tokenPrefixAmp | '^'
   
   tokenPrefixPipe       = 1 << 19
   tokenLogicalOr        = tokenPrefixPipe | '|'
   
+  tokenPrefixQuestion   = 1 << 21
+  tokenCoalesce         = tokenPrefixQuestion | '?'
+  tokenSafeDot          = tokenPrefixQuestion | '.'
+  tokenSafeBracket      = tokenPrefixQuestion | '['
+  
+  tokenPrefixLess       = 1 << 22
+  tokenShiftLeft        = tokenPrefixLess | '<'
+  
+  tokenPrefixGreater    = 1 << 23
+  tokenShiftRight       = tokenPrefixGreater | '>'
+  
   tokenSuffixEqual      = 1 << 20
   tokenEqual            = tokenSuffixEqual | '='
   tokenAddEqual         = tokenSuffixEqual | '+'
@@ -221,6 +258,20 @@ func (t tokenType) String() string {
       return "break"
     case tokenContinue:
       return "continue"
+    case tokenSwitch:
+      return "switch"
+    case tokenCase:
+      return "case"
+    case tokenDefault:
+      return "default"
+    case tokenFallthrough:
+      return "fallthrough"
+    case tokenFunc:
+      return "func"
+    case tokenCapture:
+      return "capture"
+    case tokenMap:
+      return "map"
     case tokenTrue:
       return "true"
     case tokenFalse:
@@ -229,14 +280,34 @@ func (t tokenType) String() string {
       return "nil"
     case tokenRange:
       return "range"
+    case tokenInclude:
+      return "include"
+    case tokenExtends:
+      return "extends"
+    case tokenBlockDecl:
+      return "block"
+    case tokenSuper:
+      return "super"
     case tokenInc:
       return "++"
     case tokenDec:
       return "--"
     case tokenLogicalAnd:
       return "&&"
+    case tokenAndNot:
+      return "&^"
+    case tokenShiftLeft:
+      return "<<"
+    case tokenShiftRight:
+      return ">>"
     case tokenLogicalOr:
       return "||"
+    case tokenCoalesce:
+      return "??"
+    case tokenSafeDot:
+      return "?."
+    case tokenSafeBracket:
+      return "?["
     case tokenEqual:
       return "=="
     case tokenAddEqual:
@@ -261,7 +332,7 @@ func (t tokenType) String() string {
       return "|="
     default:
       if t < 128 {
-        return fmt.Sprintf("'%v'", string(t))
+        return fmt.Sprintf("'%v'", string(rune(t)))
       }else{
         return fmt.Sprintf("%U", t)
       }
@@ -325,8 +396,76 @@ func (s *scannerError) Error() string {
 const (
   mtypeExpr     = iota
   mtypeControl  = iota
+  mtypeCall     = iota
+  mtypeStatement = iota
 )
 
+/**
+ * Keywords
+ */
+var keywords = map[string]tokenType{
+  "if":          tokenIf,
+  "else":        tokenElse,
+  "for":         tokenFor,
+  "break":       tokenBreak,
+  "continue":    tokenContinue,
+  "true":        tokenTrue,
+  "false":       tokenFalse,
+  "nil":         tokenNil,
+  "range":       tokenRange,
+}
+
+/**
+ * Keywords which are only recognized at the beginning of a meta, where they
+ * introduce a statement. Elsewhere, such as in expressions and after '.', they
+ * are identifiers like any other.
+ */
+var leadKeywords = map[string]tokenType{
+  "capture":     tokenCapture,
+  "func":        tokenFunc,
+  "switch":      tokenSwitch,
+  "case":        tokenCase,
+  "default":     tokenDefault,
+  "fallthrough": tokenFallthrough,
+  "include":     tokenInclude,
+  "extends":     tokenExtends,
+  "block":       tokenBlockDecl,
+  "super":       tokenSuper,
+}
+
+/**
+ * Look up a keyword, given whether it begins a meta
+ */
+func keyword(w string, lead bool) (tokenType, bool) {
+  if k, ok := keywords[w]; ok {
+    return k, true
+  }
+  if lead {
+    if k, ok := leadKeywords[w]; ok {
+      return k, true
+    }
+  }
+  return tokenError, false
+}
+
+/**
+ * Keywords which introduce a simple statement
+ */
+var statementKeywords = map[string]struct{}{
+  "break":       {},
+  "continue":    {},
+  "fallthrough": {},
+}
+
+/**
+ * Keywords which introduce a statement that ends with its closing parenthesis
+ */
+var callKeywords = map[string]struct{}{
+  "include": {},
+  "extends": {},
+  "super":   {},
+}
+
 /**
  * A scanner
  */
@@ -339,7 +478,12 @@ type scanner struct {
   tokens  chan token
   state   scannerAction
   paren   int
+  nest    int // the depth of brackets and braces in list and map literals
   mtype   int
+  last    tokenType // the most recently emitted token type
+  lead    bool      // the next token begins a meta
+  trim    bool      // remove lines which consist only of statements
+  trimmed []token   // the remaining tokens after trimming
 }
 
 /**
@@ -347,13 +491,42 @@ type scanner struct {
  */
 func newScanner(text string) *scanner {
   t := make(chan token, 64 /* several tokens may be produced in one iteration */)
-  return &scanner{text, 0, 0, 0, 0, t, startAction, 0, 0}
+  return &scanner{text, 0, 0, 0, 0, t, startAction, 0, 0, 0, tokenError, false, false, nil}
 }
 
 /**
  * Scan and produce a token
  */
 func (s *scanner) scan() token {
+  if !s.trim {
+    return s.produce()
+  }
+  
+  // lines can only be trimmed once all the tokens on them are known, so the
+  // entire input is scanned up front
+  if s.trimmed == nil {
+    var tokens []token
+    for {
+      t := s.produce()
+      tokens = append(tokens, t)
+      if t.which == tokenEOF || t.which == tokenError {
+        break
+      }
+    }
+    s.trimmed = trimLines(s.text, tokens)
+  }
+  
+  t := s.trimmed[0]
+  if len(s.trimmed) > 1 {
+    s.trimmed = s.trimmed[1:]
+  }
+  return t
+}
+
+/**
+ * Produce the next token from input
+ */
+func (s *scanner) produce() token {
   for {
     select {
       case t := <- s.tokens:
@@ -381,6 +554,8 @@ func (s *scanner) errorf(where span, cause error, format string, args ...interfa
 func (s *scanner) emit(t token) {
   s.tokens <- t
   s.start = t.span.offset + t.span.length
+  s.last = t.which
+  s.lead = t.which == tokenMeta
 }
 
 /**
@@ -476,6 +651,21 @@ func (s *scanner) findFrom(index int, any string, invert bool) int {
   }
 }
 
+/**
+ * Obtain the identifier at the current index without consuming it
+ */
+func (s *scanner) word() string {
+  i := s.index
+  for i < len(s.text) {
+    r, w := utf8.DecodeRuneInString(s.text[i:])
+    if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+      break
+    }
+    i += w
+  }
+  return s.text[s.index:i]
+}
+
 /**
  * Shuffle the token start to the current index
  */
@@ -524,6 +714,12 @@ func startAction(s *scanner) scannerAction {
       r := s.text[s.index]
       switch {
         
+        case r == meta && (s.match("@*") || s.match("@//")):
+          if s.index > s.start {
+            s.emit(token{span{s.text, s.start, s.index - s.start}, tokenVerbatim, s.text[s.start:s.index]})
+          }
+          return commentAction
+          
         case r == meta:
           if s.index > s.start {
             s.emit(token{span{s.text, s.start, s.index - s.start}, tokenVerbatim, s.text[s.start:s.index]})
@@ -580,6 +776,28 @@ func startAction(s *scanner) scannerAction {
   return nil
 }
 
+/**
+ * Comment action. A template comment is either delimited by '@*' and '*@' or
+ * begins with '@//' and continues to the end of the line, exclusive of the
+ * newline. Comments produce no tokens.
+ */
+func commentAction(s *scanner) scannerAction {
+  if s.match("@//") {
+    if i := strings.IndexByte(s.text[s.index:], '\n'); i < 0 {
+      s.move(len(s.text))
+    }else{
+      s.move(s.index + i)
+    }
+  }else{
+    if i := strings.Index(s.text[s.index+2:], "*@"); i < 0 {
+      return s.error(s.errorf(span{s.text, s.index, 2}, nil, "Comment not terminated"))
+    }else{
+      s.move(s.index + 2 + i + 2)
+    }
+  }
+  return startAction
+}
+
 /**
  * Prelude action. This introduces a meta expression or control structure.
  */
@@ -587,14 +805,25 @@ func preludeAction(s *scanner) scannerAction {
   s.emit(token{span{s.text, s.index, 1}, tokenMeta, "@"})
   s.next() // skip the '@' delimiter
   
-  // if the meta begins with an open parenthesis it is an expression, otherwise
-  // it is a control structure (if, for, etc)
-  if s.next() == '(' {
+  // if the meta begins with an open parenthesis it is an expression, if it
+  // begins with a call keyword or a function call it is a statement that ends
+  // with its closing parenthesis, if it begins with any other identifier it is
+  // a simple statement (assignment, etc), otherwise it is a control structure
+  // (if, for, etc)
+  w := s.word()
+  if s.peek() == '(' {
     s.mtype = mtypeExpr
+  }else if _, ok := callKeywords[w]; ok {
+    s.mtype = mtypeCall
+  }else if _, ok := keyword(w, true); !ok && w != "" && s.matchAt(s.index + len(w), "(") {
+    s.mtype = mtypeCall
+  }else if _, ok := keyword(w, true); !ok && w != "" {
+    s.mtype = mtypeStatement
+  }else if _, ok := statementKeywords[w]; ok {
+    s.mtype = mtypeStatement
   }else{
     s.mtype = mtypeControl
   }
-  s.backup()
   
   return metaAction
 }
@@ -608,11 +837,49 @@ func metaAction(s *scanner) scannerAction {
     switch r := s.next(); {
       
       case r == eof:
+        if s.endsStatement() {
+          return startAction
+        }
         return s.error(s.errorf(span{s.text, s.index, 1}, nil, "Unexpected end-of-input"))
         
+      case r == '\n' && s.last.endsLine():
+        s.backup() // the newline is not part of the statement
+        if s.endsStatement() {
+          return startAction
+        }
+        s.next()
+        s.ignore()
+        
       case unicode.IsSpace(r):
         s.ignore()
         
+      case r == '}' && s.nest > 0:
+        s.nest--
+        s.emit(token{span{s.text, s.start, s.index - s.start}, tokenRBrace, string(r)})
+        return metaAction
+        
+      case r == '}':
+        s.backup()
+        if s.endsStatement() {
+          return startAction
+        }
+        return s.error(s.errorf(span{s.text, s.index, 1}, nil, "Syntax error in meta"))
+        
+      case r == '/' && (s.peek() == '/' || s.peek() == '*'):
+        if err := s.scanComment(); err != nil {
+          return s.error(s.errorf(span{s.text, s.start, s.index - s.start}, err, "Invalid comment"))
+        }
+        s.ignore()
+        
+      case r == ';' && s.mtype == mtypeStatement && s.paren == 0:
+        s.emit(token{span{s.text, s.start, s.index - s.start}, tokenSemi, string(r)})
+        return startAction
+        
+      case r == '{' && s.opensLiteral(): // open a map literal
+        s.nest++
+        s.emit(token{span{s.text, s.start, s.index - s.start}, tokenLBrace, string(r)})
+        return metaAction
+        
       case r == '{': // open verbatim
         s.backup()
         return blockAction
@@ -637,21 +904,26 @@ func metaAction(s *scanner) scannerAction {
       case r == ')':
         s.paren--
         s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
-        if s.paren == 0 && s.mtype == mtypeExpr {
+        if s.paren == 0 && (s.mtype == mtypeExpr || s.mtype == mtypeCall) {
           return startAction
         }else{
           return metaAction
         }
         
       case r == '[' || r == ']' || r == '.' || r == ',' || r == ';':
+        if r == '[' {
+          s.nest++
+        }else if r == ']' && s.nest > 0 {
+          s.nest--
+        }
         s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
         return metaAction
         
       case r == '&':
         if n := s.next(); n == '=' {
           s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenSuffixEqual | r), string(r)})
-        }else if n == '&' {
-          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenPrefixAmp | r), string(r)})
+        }else if n == '&' || n == '^' {
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenPrefixAmp) | tokenType(n), string(r)})
         }else{
           s.backup()
           s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
@@ -691,6 +963,35 @@ func metaAction(s *scanner) scannerAction {
         }
         return metaAction
       
+      case r == '?':
+        if n := s.next(); n == '?' || n == '.' || n == '[' {
+          if n == '[' {
+            s.nest++
+          }
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenPrefixQuestion) | tokenType(n), string(r)})
+        }else{
+          s.backup()
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
+        }
+        return metaAction
+      
+      case r == '<' || r == '>':
+        if n := s.next(); n == '=' {
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenSuffixEqual | r), string(r)})
+        }else if n == '<' && r == '<' {
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenShiftLeft, string(r)})
+        }else if n == '>' && r == '>' {
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenShiftRight, string(r)})
+        }else{
+          s.backup()
+          s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
+        }
+        return metaAction
+      
+      case r == '^':
+        s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(r), string(r)})
+        return metaAction
+      
       case r == ':':
         if n := s.next(); n == '=' {
           s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenSuffixEqual | r), string(r)})
@@ -700,7 +1001,7 @@ func metaAction(s *scanner) scannerAction {
         }
         return metaAction
       
-      case r == '=' || r == '!' || r == '<' || r == '>' || r == ':' || r == '*' || r == '/':
+      case r == '=' || r == '!' || r == ':' || r == '*' || r == '/' || r == '%':
         if n := s.next(); n == '=' {
           s.emit(token{span{s.text, s.start, s.index - s.start}, tokenType(tokenSuffixEqual | r), string(r)})
         }else{
@@ -715,7 +1016,42 @@ func metaAction(s *scanner) scannerAction {
     }
   }
   
-  return startAction
+}
+
+/**
+ * Determine if an open brace begins a map literal rather than a verbatim block.
+ * Braces are literals within expressions, simple statements and other literals
+ * and following the 'map' keyword; in control structures they open a block.
+ */
+func (s *scanner) opensLiteral() bool {
+  return s.paren > 0 || s.nest > 0 || s.mtype == mtypeStatement || s.last == tokenMap
+}
+
+/**
+ * If we are at the end of a simple statement, emit its terminating semicolon
+ * and return true. The current position is not consumed.
+ */
+func (s *scanner) endsStatement() bool {
+  if s.mtype != mtypeStatement || s.paren != 0 || s.nest != 0 {
+    return false
+  }
+  s.ignore()
+  s.emit(token{span{s.text, s.index, 0}, tokenSemi, ";"})
+  return true
+}
+
+/**
+ * Determine if a newline following a token of this type ends a simple statement
+ */
+func (t tokenType) endsLine() bool {
+  switch t {
+    case tokenIdentifier, tokenNumber, tokenString, tokenTrue, tokenFalse, tokenNil, tokenBreak, tokenContinue, tokenFallthrough:
+      return true
+    case tokenRParen, tokenRBracket, tokenRBrace, tokenInc, tokenDec:
+      return true
+    default:
+      return false
+  }
 }
 
 /**
@@ -741,6 +1077,7 @@ func closeAction(s *scanner) scannerAction {
   f := s.findFrom(s.index, " \n\r\t\v", true)
   if s.matchAt(f, "else") {
     s.move(f)
+    s.mtype = mtypeControl // the else continues the enclosing control structure
     return identifierAction
   }else if s.matchAt(f, "\\else") {
     // move past the \ escape, which should be ignored in this specific case
@@ -766,10 +1103,11 @@ func stringAction(s *scanner) scannerAction {
  * Number string
  */
 func numberAction(s *scanner) scannerAction {
-  if v, _, err := s.scanNumber(); err != nil {
+  if v, k, err := s.scanNumber(); err != nil {
     s.error(s.errorf(span{s.text, s.index, 1}, err, "Invalid number"))
   }else{
-    s.emit(token{span{s.text, s.start, s.index - s.start}, tokenNumber, v})
+    t := span{s.text, s.start, s.index - s.start}
+    s.emit(token{t, tokenNumber, numberLiteral{v, k, t.excerpt()}})
   }
   return metaAction
 }
@@ -784,28 +1122,16 @@ func identifierAction(s *scanner) scannerAction {
     s.error(s.errorf(span{s.text, s.index, 1}, err, "Invalid identifier"))
   }
   
+  // 'map' is only a keyword when it introduces a map literal
   t := span{s.text, s.start, s.index - s.start}
-  switch v {
-    case "if":
-      s.emit(token{t, tokenIf, v})
-    case "else":
-      s.emit(token{t, tokenElse, v})
-    case "for":
-      s.emit(token{t, tokenFor, v})
-    case "break":
-      s.emit(token{t, tokenBreak, v})
-    case "continue":
-      s.emit(token{t, tokenContinue, v})
-    case "true":
-      s.emit(token{t, tokenTrue, v})
-    case "false":
-      s.emit(token{t, tokenFalse, v})
-    case "nil":
-      s.emit(token{t, tokenNil, nil})
-    case "range":
-      s.emit(token{t, tokenRange, v})
-    default:
-      s.emit(token{t, tokenIdentifier, v})
+  if v == "map" && s.peek() == '{' {
+    s.emit(token{t, tokenMap, v})
+  }else if k, ok := keyword(v, s.lead); !ok {
+    s.emit(token{t, tokenIdentifier, v})
+  }else if k == tokenNil {
+    s.emit(token{t, tokenNil, nil})
+  }else{
+    s.emit(token{t, k, v})
   }
   
   return metaAction
@@ -844,7 +1170,6 @@ func (s *scanner) scanString(quote, escape rune) (string, error) {
     }
   }
   
-  return "", s.errorf(span{s.text, s.start, s.index - s.start}, nil, "Unexpected end-of-input")
 }
 
 /**
@@ -989,9 +1314,10 @@ func (s *scanner) scanExponent(ch rune) rune {
 }
 
 /**
- * Scan a number
+ * Scan a number. Integers are produced as int64, or uint64 if they are too
+ * large to be represented as int64; floats are produced as float64.
  */
-func (s *scanner) scanNumber() (float64, numericType, error) {
+func (s *scanner) scanNumber() (interface{}, numericType, error) {
   start := s.index
   ch := s.next()
   
@@ -1015,11 +1341,7 @@ func (s *scanner) scanNumber() (float64, numericType, error) {
 				return 0, 0, s.errorf(span{s.text, start, s.index - start}, nil, "Illegal hexadecimal number")
 			}
 			
-			if v, err := strconv.ParseInt(s.text[start+2:s.index], 16, 64); err != nil {
-				return 0, 0, s.errorf(span{s.text, start, s.index - start}, err, "Could not parse number")
-			}else{
-			  return float64(v), numericInteger, nil
-			}
+			return s.parseInteger(start, start+2, 16)
 			
 		} else {
 		  
@@ -1030,21 +1352,22 @@ func (s *scanner) scanNumber() (float64, numericType, error) {
 				ch = s.next()
 			}
 			
+			// float with a leading zero
+			if ch == '.' || ch == 'e' || ch == 'E' {
+				return s.parseFloat(start, ch)
+			}
+			
 			s.backup() // unscan the stop rune
 			
 			// octal int
 			if has8or9 {
-				s.errorf(span{s.text, start, s.index - start}, nil, "Illegal octal number")
+				return 0, 0, s.errorf(span{s.text, start, s.index - start}, nil, "Illegal octal number")
 			}
 			
-      t := s.text[start+1:s.index]
-      if t == "" { // no more text, this is a zero
-        return 0, numericInteger, nil
-			}else if v, err := strconv.ParseInt(t, 8, 64); err != nil {
-				return 0, 0, s.errorf(span{s.text, start, s.index - start}, err, "Could not parse number")
-			}else{
-			  return float64(v), numericInteger, nil
+      if s.index == start + 1 { // no more text, this is a zero
+        return int64(0), numericInteger, nil
 			}
+			return s.parseInteger(start, start+1, 8)
 			
 		}
 	}
@@ -1054,28 +1377,75 @@ func (s *scanner) scanNumber() (float64, numericType, error) {
 	
 	// float
 	if ch == '.' || ch == 'e' || ch == 'E' {
-		// float
-		ch = s.scanFraction(ch)
-		ch = s.scanExponent(ch)
-    // unscan the non-numeric rune
-    s.backup()
-    if v, err := strconv.ParseFloat(s.text[start:s.index], 64); err != nil {
-      return 0, 0, s.errorf(span{s.text, start, s.index - start}, err, "Could not parse number")
-    }else{
-      return v, numericInteger, nil
-    }
-	}else{
-    // unscan the non-numeric rune
-    s.backup()
+		return s.parseFloat(start, ch)
 	}
 	
+  // unscan the non-numeric rune
+  s.backup()
+	
 	// integer
-  if v, err := strconv.ParseInt(s.text[start:s.index], 10, 64); err != nil {
+	return s.parseInteger(start, start, 10)
+}
+
+/**
+ * Parse the float which begins at the provided offset. The current rune is
+ * the first rune which follows the mantissa.
+ */
+func (s *scanner) parseFloat(start int, ch rune) (interface{}, numericType, error) {
+  ch = s.scanFraction(ch)
+  ch = s.scanExponent(ch)
+  // unscan the non-numeric rune
+  s.backup()
+  if v, err := strconv.ParseFloat(s.text[start:s.index], 64); err != nil {
     return 0, 0, s.errorf(span{s.text, start, s.index - start}, err, "Could not parse number")
   }else{
-    return float64(v), numericInteger, nil
+    return v, numericFloat, nil
+  }
+}
+
+/**
+ * Parse the integer which begins at the provided offset, the digits of which
+ * begin at the offset of its mantissa.
+ */
+func (s *scanner) parseInteger(start, mantissa, base int) (interface{}, numericType, error) {
+  v, err := strconv.ParseUint(s.text[mantissa:s.index], base, 64)
+  if err != nil {
+    return 0, 0, s.errorf(span{s.text, start, s.index - start}, err, "Could not parse number")
+  }else if v > math.MaxInt64 {
+    return v, numericInteger, nil
+  }else{
+    return int64(v), numericInteger, nil
+  }
+}
+
+/**
+ * Scan a comment in a meta expression. The opening '/' is expected to have
+ * already been consumed. A line comment ends before the newline that
+ * terminates it.
+ */
+func (s *scanner) scanComment() error {
+  if s.next() == '/' {
+    for {
+      switch s.next() {
+        case eof:
+          return nil
+        case '\n':
+          s.backup() // the newline is not part of the comment
+          return nil
+      }
+    }
+  }
+  for {
+    switch s.next() {
+      case eof:
+        return fmt.Errorf("Comment not terminated")
+      case '*':
+        if s.peek() == '/' {
+          s.next()
+          return nil
+        }
+    }
   }
-  
 }
 
 /*
@@ -1084,32 +1454,5 @@ func (s *scanner) scanChar() {
 		s.error("illegal char literal")
 	}
 }
-
-func (s *scanner) scanComment(ch rune) rune {
-	// ch == '/' || ch == '*'
-	if ch == '/' {
-		// line comment
-		ch = s.next() // read character after "//"
-		for ch != '\n' && ch >= 0 {
-			ch = s.next()
-		}
-		return ch
-	}
-
-	// general comment
-	ch = s.next() // read character after "/*"
-	for {
-		if ch < 0 {
-			s.error("comment not terminated")
-			break
-		}
-		ch0 := ch
-		ch = s.next()
-		if ch0 == '*' && ch == '/' {
-			ch = s.next()
-			break
-		}
-	}
-	return ch
-}
 */
+
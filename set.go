@@ -0,0 +1,245 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "path"
+  "sync"
+  "time"
+  "io/fs"
+  "strings"
+)
+
+/**
+ * A set of named templates loaded from a filesystem. Every template in the
+ * set is compiled when the set is created. A set is safe for concurrent use.
+ * 
+ * A set is also a Loader, and it is used to resolve includes and layouts
+ * when templates are executed through it.
+ */
+type Set struct {
+  // When Reload is true, templates are recompiled when their source changes
+  // and templates added after the set was created are loaded on demand. This
+  // is useful during development. It must be set before the set is used.
+  Reload    bool
+  // The runtime settings used by ExecuteTemplate, such as the escaping mode.
+  // The output writer is replaced by the one provided for each execution.
+  Defaults  Runtime
+  opts      Options
+  fsys      fs.FS
+  lock      sync.RWMutex
+  templates map[string]*setEntry
+}
+
+/**
+ * A compiled template in a set
+ */
+type setEntry struct {
+  prog      *Program
+  modtime   time.Time
+}
+
+/**
+ * Create a set from the templates in a directory tree
+ */
+func NewDirSet(root string) (*Set, error) {
+  return NewSet(os.DirFS(root))
+}
+
+/**
+ * Create a set from the templates in a filesystem. Templates are files with
+ * the extension ".ego" or with ".ego" before their final extension, as in
+ * "index.ego.html", and are named by their slash-separated path.
+ */
+func NewSet(fsys fs.FS) (*Set, error) {
+  return NewSetWithOptions(fsys, Options{})
+}
+
+/**
+ * Create a set from the templates in a filesystem, compiling them with the
+ * provided options
+ */
+func NewSetWithOptions(fsys fs.FS, opts Options) (*Set, error) {
+  s := &Set{opts:opts, fsys:fsys, templates:make(map[string]*setEntry)}
+  
+  err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+    if err != nil {
+      return err
+    }
+    if d.IsDir() || !isTemplateName(p) {
+      return nil
+    }
+    e, err := s.compile(p)
+    if err != nil {
+      return err
+    }
+    s.templates[p] = e
+    return nil
+  })
+  if err != nil {
+    return nil, err
+  }
+  
+  return s, nil
+}
+
+/**
+ * Obtain the names of the templates in the set
+ */
+func (s *Set) Names() []string {
+  s.lock.RLock()
+  defer s.lock.RUnlock()
+  n := make([]string, 0, len(s.templates))
+  for k := range s.templates {
+    n = append(n, k)
+  }
+  return n
+}
+
+/**
+ * Look up a template by name. If the template does not exist, or if it was
+ * modified and could not be recompiled, nil is returned.
+ */
+func (s *Set) Lookup(name string) *Program {
+  prog, err := s.Load(name)
+  if err != nil {
+    return nil
+  }
+  return prog
+}
+
+/**
+ * Load a template by name
+ */
+func (s *Set) Load(name string) (*Program, error) {
+  name = strings.TrimPrefix(name, "/")
+  
+  s.lock.RLock()
+  e, ok := s.templates[name]
+  s.lock.RUnlock()
+  
+  if !s.Reload {
+    if !ok {
+      return nil, &fs.PathError{Op:"load", Path:name, Err:fs.ErrNotExist}
+    }
+    return e.prog, nil
+  }
+  
+  info, err := fs.Stat(s.fsys, name)
+  if err != nil {
+    if ok {
+      s.lock.Lock()
+      delete(s.templates, name)
+      s.lock.Unlock()
+    }
+    return nil, err
+  }
+  if ok && info.ModTime().Equal(e.modtime) {
+    return e.prog, nil
+  }
+  
+  e, err = s.compile(name)
+  if err != nil {
+    return nil, err
+  }
+  
+  s.lock.Lock()
+  s.templates[name] = e
+  s.lock.Unlock()
+  
+  return e.prog, nil
+}
+
+/**
+ * Execute a template by name with the set's default runtime settings,
+ * writing output to the provided writer
+ */
+func (s *Set) ExecuteTemplate(w io.Writer, name string, cxt interface{}) error {
+  rt := s.Defaults.settings()
+  rt.Stdout = w
+  return s.Exec(rt, name, cxt)
+}
+
+/**
+ * Execute a template by name with the provided runtime. If the runtime does
+ * not have a loader, the set is used. The runtime is left as it was found.
+ */
+func (s *Set) Exec(rt *Runtime, name string, cxt interface{}) error {
+  
+  prog, err := s.Load(name)
+  if err != nil {
+    return err
+  }
+  
+  loader, includes := rt.Loader, rt.includes
+  defer func() { rt.Loader, rt.includes = loader, includes }()
+  
+  if rt.Loader == nil {
+    rt.Loader = s
+  }
+  rt.includes = []string{strings.TrimPrefix(name, "/")}
+  
+  return prog.Exec(rt, cxt)
+}
+
+/**
+ * Compile a template
+ */
+func (s *Set) compile(name string) (*setEntry, error) {
+  
+  info, err := fs.Stat(s.fsys, name)
+  if err != nil {
+    return nil, err
+  }
+  
+  data, err := fs.ReadFile(s.fsys, name)
+  if err != nil {
+    return nil, err
+  }
+  
+  prog, err := CompileWithOptions(string(data), s.opts)
+  if err != nil {
+    return nil, fmt.Errorf("%v: %v", name, err)
+  }
+  
+  return &setEntry{prog, info.ModTime()}, nil
+}
+
+/**
+ * Determine if a file name looks like a template
+ */
+func isTemplateName(p string) bool {
+  b := path.Base(p)
+  return strings.HasSuffix(b, ".ego") || strings.Contains(b, ".ego.")
+}
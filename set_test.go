@@ -0,0 +1,156 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "sync"
+  "sort"
+  "time"
+  "strings"
+  "testing"
+  "testing/fstest"
+)
+
+import (
+  "github.com/stretchr/testify/assert"
+)
+
+/**
+ * Test template sets
+ */
+func TestSet(t *testing.T) {
+  fsys := fstest.MapFS{
+    "layout.ego":           &fstest.MapFile{Data:[]byte(`<main>@block content {}</main>`)},
+    "index.ego.html":       &fstest.MapFile{Data:[]byte(`@extends("layout.ego")@block content {@include("partials/item.ego")}`)},
+    "partials/item.ego":    &fstest.MapFile{Data:[]byte(`Item @(name)`)},
+    "notes.txt":            &fstest.MapFile{Data:[]byte(`Not a template @(`)},
+  }
+  
+  set, err := NewSet(fsys)
+  if !assert.Nil(t, err, "%v", err) { return }
+  
+  names := set.Names()
+  sort.Strings(names)
+  assert.Equal(t, []string{"index.ego.html", "layout.ego", "partials/item.ego"}, names)
+  
+  assert.NotNil(t, set.Lookup("layout.ego"))
+  assert.Nil(t, set.Lookup("notes.txt"))
+  assert.Nil(t, set.Lookup("missing.ego"))
+  
+  var wg sync.WaitGroup
+  for i := 0; i < 10; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      out := &strings.Builder{}
+      err := set.ExecuteTemplate(out, "index.ego.html", map[string]interface{}{"name": "One"})
+      if assert.Nil(t, err, "%v", err) {
+        assert.Equal(t, `<main>Item One</main>`, out.String())
+      }
+    }()
+  }
+  wg.Wait()
+  
+  err = set.ExecuteTemplate(&strings.Builder{}, "missing.ego", nil)
+  assert.NotNil(t, err)
+  
+  // the caller's runtime is left as it was found
+  out := &strings.Builder{}
+  rt := &Runtime{Stdout:out, includes:[]string{"outer.ego"}}
+  err = set.Exec(rt, "index.ego.html", map[string]interface{}{"name": "Two"})
+  if assert.Nil(t, err, "%v", err) {
+    assert.Equal(t, `<main>Item Two</main>`, out.String())
+  }
+  assert.Nil(t, rt.Loader)
+  assert.Equal(t, []string{"outer.ego"}, rt.includes)
+  
+  fsys["broken.ego"] = &fstest.MapFile{Data:[]byte(`@(`)}
+  _, err = NewSet(fsys)
+  assert.NotNil(t, err)
+  
+}
+
+/**
+ * Test reloading templates
+ */
+func TestSetReload(t *testing.T) {
+  fsys := fstest.MapFS{
+    "a.ego": &fstest.MapFile{Data:[]byte(`A1`), ModTime:time.Unix(1, 0)},
+  }
+  
+  static, err := NewSet(fsys)
+  if !assert.Nil(t, err, "%v", err) { return }
+  
+  set, err := NewSet(fsys)
+  if !assert.Nil(t, err, "%v", err) { return }
+  set.Reload = true
+  
+  out := &strings.Builder{}
+  set.ExecuteTemplate(out, "a.ego", nil)
+  assert.Equal(t, `A1`, out.String())
+  
+  fsys["a.ego"] = &fstest.MapFile{Data:[]byte(`A2`), ModTime:time.Unix(2, 0)}
+  fsys["b.ego"] = &fstest.MapFile{Data:[]byte(`B1`), ModTime:time.Unix(2, 0)}
+  
+  out = &strings.Builder{}
+  static.ExecuteTemplate(out, "a.ego", nil)
+  assert.Equal(t, `A1`, out.String())
+  assert.Nil(t, static.Lookup("b.ego"))
+  
+  out = &strings.Builder{}
+  set.ExecuteTemplate(out, "a.ego", nil)
+  assert.Equal(t, `A2`, out.String())
+  assert.NotNil(t, set.Lookup("b.ego"))
+  
+  delete(fsys, "b.ego")
+  assert.Nil(t, set.Lookup("b.ego"))
+  
+}
+
+/**
+ * Test the runtime defaults of a set
+ */
+func TestSetDefaults(t *testing.T) {
+  fsys := fstest.MapFS{
+    "a.ego": &fstest.MapFile{Data:[]byte(`<p title="@(a)">@(a)</p>`)},
+  }
+  
+  set, err := NewSet(fsys)
+  if !assert.Nil(t, err, "%v", err) { return }
+  set.Defaults.Escape = EscapeHTML
+  
+  out := &strings.Builder{}
+  err = set.ExecuteTemplate(out, "a.ego", map[string]interface{}{"a": `"<b>"`})
+  if assert.Nil(t, err, "%v", err) {
+    assert.Equal(t, `<p title="&#34;&lt;b&gt;&#34;">&#34;&lt;b&gt;&#34;</p>`, out.String())
+  }
+  
+}
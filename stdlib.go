@@ -32,14 +32,23 @@ package ego
 
 import (
   "fmt"
+  "math/big"
   "reflect"
+  "strconv"
+  "strings"
 )
 
 /**
  * Builtins
  */
 var stdlib = map[string]interface{}{
-  "len": builtinLen,
+  "len":      builtinLen,
+  "raw":      builtinRaw,
+  "upper":    builtinUpper,
+  "lower":    builtinLower,
+  "trim":     builtinTrim,
+  "truncate": builtinTruncate,
+  "decimal":  builtinDecimal,
 }
 
 /**
@@ -54,3 +63,101 @@ func builtinLen(a interface{}) (int, error) {
       return 0, fmt.Errorf("Invalid parameter for builtin 'len'")
   }
 }
+
+/**
+ * raw()
+ */
+func builtinRaw(a interface{}) SafeHTML {
+  switch v := a.(type) {
+    case nil:
+      return ""
+    case string:
+      return SafeHTML(v)
+    case []byte:
+      return SafeHTML(v)
+    default:
+      return SafeHTML(fmt.Sprintf("%v", v))
+  }
+}
+
+/**
+ * upper()
+ */
+func builtinUpper(a interface{}) string {
+  return strings.ToUpper(stringValue(a))
+}
+
+/**
+ * lower()
+ */
+func builtinLower(a interface{}) string {
+  return strings.ToLower(stringValue(a))
+}
+
+/**
+ * trim()
+ */
+func builtinTrim(a interface{}) string {
+  return strings.TrimSpace(stringValue(a))
+}
+
+/**
+ * truncate()
+ */
+func builtinTruncate(a interface{}, n int) (string, error) {
+  if n < 0 {
+    return "", fmt.Errorf("Invalid length for builtin 'truncate': %v", n)
+  }
+  r := []rune(stringValue(a))
+  if len(r) > n {
+    r = r[:n]
+  }
+  return string(r), nil
+}
+
+/**
+ * decimal(), which formats a number with a fixed number of decimal places
+ */
+func builtinDecimal(a interface{}, n int) (string, error) {
+  if n < 0 {
+    return "", fmt.Errorf("Invalid number of places for builtin 'decimal': %v", n)
+  }
+  if isBigNumber(a) && isNil(a) {
+    return "", fmt.Errorf("Invalid parameter for builtin 'decimal': nil %T", a)
+  }
+  switch v := a.(type) {
+    case *big.Int:
+      return new(big.Rat).SetInt(v).FloatString(n), nil
+    case *big.Rat:
+      return v.FloatString(n), nil
+    case *big.Float:
+      return v.Text('f', n), nil
+  }
+  if r := reflect.ValueOf(a); isNumericKind(r.Kind()) {
+    switch v := normalizeNumber(r).(type) {
+      case float64:
+        return strconv.FormatFloat(v, 'f', n, 64), nil
+      default:
+        return toBigRat(v).FloatString(n), nil
+    }
+  }
+  return "", fmt.Errorf("Invalid parameter for builtin 'decimal': %v", displayType(reflect.ValueOf(a)))
+}
+
+/**
+ * Obtain the string representation of a value
+ */
+func stringValue(a interface{}) string {
+  switch v := a.(type) {
+    case nil:
+      return ""
+    case string:
+      return v
+    case []byte:
+      return string(v)
+    case fmt.Stringer:
+      return v.String()
+    default:
+      return fmt.Sprintf("%v", v)
+  }
+}
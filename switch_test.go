@@ -0,0 +1,120 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test switch
+ */
+func TestSwitch(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 2},
+    `@switch a { @case 1 {one} @case 2, 3 {two or three} @default {other} }`,
+    `two or three`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 5},
+    `@switch a { @default {other} @case 1 {one} }`,
+    `other`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 5},
+    `@switch a { @case 1 {one} }`,
+    ``,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": "b"},
+    `@switch a {
+      @case "a" {A}
+      @case "b" {B}
+    }`,
+    `B`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 5},
+    `@switch { @case a < 3 {small} @case a < 10 {medium} @default {large} }`,
+    `medium`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1},
+    `@switch a { @case 1 {one @fallthrough } @case 2 {two} @case 3 {three} }`,
+    `one two`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 1},
+    `@switch a { @case 1 {one @break; never} @default {other} }`,
+    `one `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@for _, e := range a {@switch e { @case 2 {@continue;} } @(e)}`,
+    ` 1 3`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": uint8(2), "b": 2.0},
+    `@switch a { @case b {equal} @default {not equal} }`,
+    `equal`,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@switch a { text @case 1 {one} }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@switch a { @case 1 {one} @default {} @default {} }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@switch a { @case 1 {one} @case 2 {two @fallthrough } }`,
+    `one`,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@switch a { @case 1 {@fallthrough one} @case 2 {two} }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@switch a { @case 1 {@if true {@fallthrough }} @case 2 {two} }`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@fallthrough`,
+    ``,
+  )
+  
+}
@@ -0,0 +1,176 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "unicode"
+  "unicode/utf8"
+)
+
+/**
+ * How a character in a template is produced
+ */
+const (
+  charMeta      = iota  // part of a statement, or a comment
+  charVerbatim          // verbatim content
+  charOutput            // part of an interpolated expression or call
+)
+
+/**
+ * Remove lines which consist only of statements from a stream of tokens. A
+ * line is removed, including its newline, when it contains at least one
+ * statement (like '@if x {', '}' or '@x := 1') or comment, does not contain
+ * any expression or call that produces output, and its verbatim content is
+ * entirely whitespace. This is accomplished by trimming the verbatim tokens
+ * which cover the removed lines.
+ */
+func trimLines(text string, tokens []token) []token {
+  chars := make([]int, len(text))
+  
+  for i := 0; i < len(tokens); i++ {
+    t := tokens[i]
+    switch t.which {
+      case tokenVerbatim:
+        markChars(chars, t.span.offset, t.span.offset + t.span.length, charVerbatim)
+      case tokenMeta:
+        if end := outputEnd(tokens, i); end > i {
+          markChars(chars, t.span.offset, tokens[end].span.offset + tokens[end].span.length, charOutput)
+          i = end
+        }
+    }
+  }
+  
+  remove := make([]bool, len(text))
+  for start := 0; start < len(text); {
+    end := start
+    for end < len(text) && text[end] != '\n' {
+      end++
+    }
+    if end < len(text) {
+      end++ // include the newline
+    }
+    if trimmableLine(text, chars, start, end) {
+      for i := start; i < end; i++ {
+        remove[i] = chars[i] == charVerbatim
+      }
+    }
+    start = end
+  }
+  
+  // since a removed line always contains a statement, only the beginning or
+  // the end of a verbatim token is ever removed
+  res := make([]token, 0, len(tokens))
+  for _, t := range tokens {
+    if t.which == tokenVerbatim {
+      start, end := t.span.offset, t.span.offset + t.span.length
+      for start < end && remove[start] {
+        start++
+      }
+      for end > start && remove[end-1] {
+        end--
+      }
+      if start == end {
+        continue
+      }
+      t.span = span{t.span.text, start, end - start}
+      t.value = text[start:end]
+    }
+    res = append(res, t)
+  }
+  
+  return res
+}
+
+/**
+ * Mark a range of characters
+ */
+func markChars(chars []int, start, end, kind int) {
+  for i := start; i < end && i < len(chars); i++ {
+    chars[i] = kind
+  }
+}
+
+/**
+ * If the meta token at the provided index begins an expression or call that
+ * produces output, return the index of the token that ends it, otherwise -1
+ */
+func outputEnd(tokens []token, i int) int {
+  n := i + 1
+  if n < len(tokens) && tokens[n].which == tokenIdentifier {
+    n++
+  }else if n < len(tokens) && (tokens[n].which == tokenInclude || tokens[n].which == tokenSuper) {
+    n++
+  }
+  if n >= len(tokens) || tokens[n].which != tokenLParen {
+    return -1
+  }
+  
+  depth := 0
+  for ; n < len(tokens); n++ {
+    switch tokens[n].which {
+      case tokenLParen:
+        depth++
+      case tokenRParen:
+        depth--
+        if depth == 0 {
+          return n
+        }
+      case tokenEOF, tokenError:
+        return n - 1
+    }
+  }
+  
+  return len(tokens) - 1
+}
+
+/**
+ * Determine if a line can be removed
+ */
+func trimmableLine(text string, chars []int, start, end int) bool {
+  var meta bool
+  for i := start; i < end; {
+    r, w := utf8.DecodeRuneInString(text[i:])
+    switch chars[i] {
+      case charOutput:
+        return false
+      case charVerbatim:
+        if !unicode.IsSpace(r) {
+          return false
+        }
+      case charMeta:
+        if !unicode.IsSpace(r) {
+          meta = true
+        }
+    }
+    i += w
+  }
+  return meta
+}
@@ -0,0 +1,111 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "bytes"
+  "testing"
+)
+
+import (
+  "github.com/stretchr/testify/assert"
+)
+
+func compileAndRunTrimmed(t *testing.T, context interface{}, source, expect string) {
+  prog, err := CompileWithOptions(source, Options{TrimLines:true})
+  if !assert.Nil(t, err) { return }
+  
+  output := &bytes.Buffer{}
+  err = prog.Exec(&Runtime{Stdout:output}, context)
+  if !assert.Nil(t, err) { return }
+  
+  assert.Equal(t, expect, string(output.Bytes()))
+}
+
+/**
+ * Test trimming lines
+ */
+func TestTrimLines(t *testing.T) {
+  
+  compileAndRunTrimmed(t, map[string]interface{}{"a": []string{"x", "y"}},
+`items:
+  @for _, e := range a {
+  - @(e)
+  }
+done
+`,
+`items:
+  - x
+  - y
+done
+`)
+  
+  compileAndRunTrimmed(t, map[string]interface{}{"a": true},
+`A
+@if a {
+  B
+} else {
+  C
+}
+D`,
+`A
+  B
+D`)
+  
+  compileAndRunTrimmed(t, map[string]interface{}{"a": 1},
+`@x := a + 1
+@* a comment *@
+@// another comment
+x = @(x)
+  @if a == 1 { one } 
+@(x)
+@if a == 1 {one}, two
+`,
+`x = 2
+   one  
+2
+one, two
+`)
+  
+  compileAndRunTrimmed(t, nil,
+`@func f(v) {
+  [@(v)]
+}
+@f(1)
+  @f(2)
+`,
+`  [1]
+
+    [2]
+
+`)
+  
+}
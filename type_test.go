@@ -44,7 +44,7 @@ func TestType(t *testing.T) {
   compileAndValidate(t, source, []token{
     token{span{source, 0, 1}, tokenMeta, "@"},
     token{span{source, 1, 1}, tokenLParen, "("},
-    token{span{source, 2, 1}, tokenNumber, float64(0)},
+    token{span{source, 2, 1}, tokenNumber, numberLiteral{int64(0), numericInteger, "0"}},
     token{span{source, 3, 1}, tokenRParen, ")"},
     token{span{source, 4, 0}, tokenEOF, nil},
   })
@@ -53,11 +53,47 @@ func TestType(t *testing.T) {
   compileAndValidate(t, source, []token{
     token{span{source, 0, 1}, tokenMeta, "@"},
     token{span{source, 1, 1}, tokenLParen, "("},
-    token{span{source, 2, 3}, tokenNumber, float64(123)},
+    token{span{source, 2, 3}, tokenNumber, numberLiteral{int64(123), numericInteger, "123"}},
     token{span{source, 5, 1}, tokenRParen, ")"},
     token{span{source, 6, 0}, tokenEOF, nil},
   })
   
+  source = `@(1.5)`
+  compileAndValidate(t, source, []token{
+    token{span{source, 0, 1}, tokenMeta, "@"},
+    token{span{source, 1, 1}, tokenLParen, "("},
+    token{span{source, 2, 3}, tokenNumber, numberLiteral{float64(1.5), numericFloat, "1.5"}},
+    token{span{source, 5, 1}, tokenRParen, ")"},
+    token{span{source, 6, 0}, tokenEOF, nil},
+  })
+  
+  source = `@(0.5)`
+  compileAndValidate(t, source, []token{
+    token{span{source, 0, 1}, tokenMeta, "@"},
+    token{span{source, 1, 1}, tokenLParen, "("},
+    token{span{source, 2, 3}, tokenNumber, numberLiteral{float64(0.5), numericFloat, "0.5"}},
+    token{span{source, 5, 1}, tokenRParen, ")"},
+    token{span{source, 6, 0}, tokenEOF, nil},
+  })
+  
+  source = `@(0x1F)`
+  compileAndValidate(t, source, []token{
+    token{span{source, 0, 1}, tokenMeta, "@"},
+    token{span{source, 1, 1}, tokenLParen, "("},
+    token{span{source, 2, 4}, tokenNumber, numberLiteral{int64(31), numericInteger, "0x1F"}},
+    token{span{source, 6, 1}, tokenRParen, ")"},
+    token{span{source, 7, 0}, tokenEOF, nil},
+  })
+  
+  source = `@(18446744073709551615)`
+  compileAndValidate(t, source, []token{
+    token{span{source, 0, 1}, tokenMeta, "@"},
+    token{span{source, 1, 1}, tokenLParen, "("},
+    token{span{source, 2, 20}, tokenNumber, numberLiteral{uint64(18446744073709551615), numericInteger, "18446744073709551615"}},
+    token{span{source, 22, 1}, tokenRParen, ")"},
+    token{span{source, 23, 0}, tokenEOF, nil},
+  })
+  
 }
 
 func TestEscaping(t *testing.T) {
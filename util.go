@@ -31,6 +31,8 @@
 package ego
 
 import (
+  "fmt"
+  "sort"
   "reflect"
   "runtime"
 )
@@ -41,3 +43,192 @@ import (
 func funcName(f reflect.Value) string {
   return runtime.FuncForPC(f.Pointer()).Name()
 }
+
+/**
+ * Determine if a value is nil, including a typed nil pointer, map, slice,
+ * function, channel or interface
+ */
+func isNil(v interface{}) bool {
+  if v == nil {
+    return true
+  }
+  switch r := reflect.ValueOf(v); r.Kind() {
+    case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+      return r.IsNil()
+    default:
+      return false
+  }
+}
+
+/**
+ * Sort map keys. Keys are ordered first by kind: nil, then booleans, then
+ * numbers, then strings, then everything else. Booleans order false before
+ * true, numbers of any type are ordered by value, strings are ordered
+ * lexically, and other values are ordered by their type name and then their
+ * default formatting.
+ */
+func sortKeys(keys []reflect.Value) {
+  sort.SliceStable(keys, func(i, j int) bool {
+    return compareKeys(keys[i], keys[j]) < 0
+  })
+}
+
+/**
+ * The rank of a map key kind, for sorting
+ */
+const (
+  keyRankNil = iota
+  keyRankBool
+  keyRankNumber
+  keyRankString
+  keyRankOther
+)
+
+/**
+ * Compare two map keys
+ */
+func compareKeys(a, b reflect.Value) int {
+  for a.Kind() == reflect.Interface && !a.IsNil() {
+    a = a.Elem()
+  }
+  for b.Kind() == reflect.Interface && !b.IsNil() {
+    b = b.Elem()
+  }
+  
+  ra, rb := keyRank(a), keyRank(b)
+  if ra != rb {
+    return ra - rb
+  }
+  
+  switch ra {
+    case keyRankNil:
+      return 0
+    case keyRankBool:
+      return compareOrdered(boolRank(a.Bool()), boolRank(b.Bool()))
+    case keyRankNumber:
+      return compareNumbers(a, b)
+    case keyRankString:
+      return compareOrdered(a.String(), b.String())
+    default:
+      if c := compareOrdered(a.Type().String(), b.Type().String()); c != 0 {
+        return c
+      }
+      return compareOrdered(fmt.Sprintf("%v", a.Interface()), fmt.Sprintf("%v", b.Interface()))
+  }
+}
+
+/**
+ * Determine the rank of a map key
+ */
+func keyRank(v reflect.Value) int {
+  switch v.Kind() {
+    case reflect.Invalid, reflect.Interface:
+      return keyRankNil
+    case reflect.Bool:
+      return keyRankBool
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      return keyRankNumber
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      return keyRankNumber
+    case reflect.Float32, reflect.Float64:
+      return keyRankNumber
+    case reflect.String:
+      return keyRankString
+    case reflect.Ptr:
+      if v.IsNil() {
+        return keyRankNil
+      }
+      return keyRankOther
+    default:
+      return keyRankOther
+  }
+}
+
+/**
+ * Compare numeric values of any kind
+ */
+func compareNumbers(a, b reflect.Value) int {
+  switch {
+    case isSignedKind(a.Kind()) && isSignedKind(b.Kind()):
+      return compareOrdered(a.Int(), b.Int())
+    case isUnsignedKind(a.Kind()) && isUnsignedKind(b.Kind()):
+      return compareOrdered(a.Uint(), b.Uint())
+    case isSignedKind(a.Kind()) && isUnsignedKind(b.Kind()):
+      if a.Int() < 0 {
+        return -1
+      }
+      return compareOrdered(uint64(a.Int()), b.Uint())
+    case isUnsignedKind(a.Kind()) && isSignedKind(b.Kind()):
+      return -compareNumbers(b, a)
+    default:
+      return compareOrdered(numberAsFloat(a), numberAsFloat(b))
+  }
+}
+
+/**
+ * Convert a numeric value to a float
+ */
+func numberAsFloat(v reflect.Value) float64 {
+  switch {
+    case isSignedKind(v.Kind()):
+      return float64(v.Int())
+    case isUnsignedKind(v.Kind()):
+      return float64(v.Uint())
+    default:
+      return v.Float()
+  }
+}
+
+/**
+ * Is a kind a signed integer
+ */
+func isSignedKind(k reflect.Kind) bool {
+  switch k {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      return true
+    default:
+      return false
+  }
+}
+
+/**
+ * Is a kind an unsigned integer
+ */
+func isUnsignedKind(k reflect.Kind) bool {
+  switch k {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      return true
+    default:
+      return false
+  }
+}
+
+/**
+ * Is a kind numeric
+ */
+func isNumericKind(k reflect.Kind) bool {
+  return isSignedKind(k) || isUnsignedKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+/**
+ * Order booleans
+ */
+func boolRank(v bool) int {
+  if v {
+    return 1
+  }
+  return 0
+}
+
+/**
+ * Compare ordered values
+ */
+func compareOrdered[T int | int64 | uint64 | float64 | string](a, b T) int {
+  if a < b {
+    return -1
+  }else if a > b {
+    return 1
+  }else{
+    return 0
+  }
+}
@@ -0,0 +1,118 @@
+// 
+// Copyright (c) 2014-2016 Brian W. Wolter, All rights reserved.
+// Ego - an embedded Go parser / compiler
+// 
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 
+//   * Redistributions of source code must retain the above copyright notice, this
+//     list of conditions and the following disclaimer.
+// 
+//   * Redistributions in binary form must reproduce the above copyright notice,
+//     this list of conditions and the following disclaimer in the documentation
+//     and/or other materials provided with the distribution.
+//     
+//   * Neither the names of Brian W. Wolter nor the names of the contributors may
+//     be used to endorse or promote products derived from this software without
+//     specific prior written permission.
+//     
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+// ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+// WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+// IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+// INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+// LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE
+// OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED
+// OF THE POSSIBILITY OF SUCH DAMAGE.
+// 
+
+package ego
+
+import (
+  "testing"
+)
+
+/**
+ * Test variable declarations and assignment
+ */
+func TestVariables(t *testing.T) {
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": 10},
+    `@x := a + 1
+@(x)`,
+    "\n11",
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := 1; @x = x * 2; @x += 3; @x -= 1; @x *= 5; @x /= 2; @x++; @x++; @x--; @(x)`,
+    `         11`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@a, b := 1, "two"; @a, b = b, a; @(a), @(b)`,
+    `  two, 1`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"x": "context"},
+    `@(x) @x := "outer"; @(x) @if true {@x := "inner"; @(x)} @(x)`,
+    `context  outer  inner outer`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := "outer"; @if true {@x = "inner"} @(x)`,
+    `  inner`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3, 4}},
+    `@sum := 0; @for _, e := range a {@sum += e} @(sum)`,
+    `  10`,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"a": []int{1, 2, 3}},
+    `@for _, e := range a {@e *= 10; @(e) }`,
+    ` 10  20  30 `,
+  )
+  
+  compileAndRun(t, true, true, map[string]interface{}{"x": "context"},
+    `@x := nil; [@(x)]`,
+    ` []`,
+  )
+  
+  compileAndRun(t, true, true, nil,
+    `@x := 1`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@x = 1;`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@if true {@x := 1} @x++`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@x := 1; @x := 2;`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@x, y := 1;`,
+    ``,
+  )
+  
+  compileAndRun(t, false, false, nil,
+    `@x := 1 Text`,
+    ``,
+  )
+  
+  compileAndRun(t, true, false, nil,
+    `@x := "a"; @x++`,
+    ``,
+  )
+  
+}